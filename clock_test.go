@@ -0,0 +1,163 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"github.com/popeskul/ratelimiter"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("Advance Fires Due Timers", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		early := clock.NewTimer(time.Second)
+		late := clock.NewTimer(time.Minute)
+
+		clock.Advance(2 * time.Second)
+
+		select {
+		case fired := <-early.C():
+			if !fired.Equal(start.Add(time.Second)) {
+				t.Errorf("Expected the timer to fire at its deadline, got %v", fired)
+			}
+		default:
+			t.Error("Timer due after 1s should have fired")
+		}
+		select {
+		case <-late.C():
+			t.Error("Timer due after 1m should not have fired")
+		default:
+		}
+
+		if got := clock.Now(); !got.Equal(start.Add(2 * time.Second)) {
+			t.Errorf("Expected now to be 2s after start, got %v", got)
+		}
+		if pending := clock.PendingTimers(); pending != 1 {
+			t.Errorf("Expected 1 pending timer, got %d", pending)
+		}
+	})
+
+	t.Run("Stop And Reset", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		timer := clock.NewTimer(time.Second)
+
+		if !timer.Stop() {
+			t.Error("Stop should report an active timer")
+		}
+		clock.Advance(time.Second)
+		select {
+		case <-timer.C():
+			t.Error("Stopped timer should not fire")
+		default:
+		}
+
+		timer.Reset(time.Second)
+		clock.Advance(time.Second)
+		select {
+		case <-timer.C():
+		default:
+			t.Error("Reset timer should fire")
+		}
+	})
+}
+
+func TestWithClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	for _, algo := range algorithms {
+		t.Run(string(algo), func(t *testing.T) {
+			clock := ratelimiter.NewFakeClock(start)
+			limiter, err := ratelimiter.New(
+				ratelimiter.WithAlgorithm(algo),
+				ratelimiter.WithRate(1),
+				ratelimiter.WithBurst(1),
+				ratelimiter.WithCapacity(1),
+				ratelimiter.WithWindow(time.Second),
+				ratelimiter.WithClock(clock),
+				ratelimiter.WithMetrics(true),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create limiter: %v", err)
+			}
+
+			if !limiter.Allow() {
+				t.Fatal("First request should be allowed")
+			}
+			if limiter.Allow() {
+				t.Fatal("Second request should be denied while time stands still")
+			}
+
+			done := make(chan error, 1)
+			go func() { done <- limiter.Wait(context.Background()) }()
+
+			// Advance in small steps once the waiter is blocked on a timer
+			clock.BlockUntil(1)
+			for i := 0; i < 30; i++ {
+				clock.Advance(100 * time.Millisecond)
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Fatalf("Wait should not error: %v", err)
+					}
+					wait := time.Duration(limiter.GetMetrics().MaxWaitTime)
+					if wait <= 0 || wait > 2*time.Second {
+						t.Errorf("Expected a virtual wait of at most 2s, got %v", wait)
+					}
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+			t.Fatal("Wait should return once the virtual clock has advanced")
+		})
+	}
+
+	t.Run("Reservation Delay", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		limiter := ratelimiter.NewFixedWindow(&ratelimiter.Config{
+			Rate:   1,
+			Window: time.Minute,
+			Clock:  clock,
+		})
+
+		limiter.Allow()
+		r := limiter.Reserve()
+		if d := r.Delay(); d != time.Minute {
+			t.Errorf("Expected a delay of exactly 1m, got %v", d)
+		}
+
+		clock.Advance(45 * time.Second)
+		if d := r.Delay(); d != 15*time.Second {
+			t.Errorf("Expected a delay of exactly 15s, got %v", d)
+		}
+	})
+
+	t.Run("Keyed TTL", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Hour),
+			ratelimiter.WithKeyTTL(time.Minute),
+			ratelimiter.WithClock(clock),
+		)
+
+		limiter.AllowKey("a")
+		clock.Advance(time.Minute)
+
+		if evicted := limiter.Prune(); evicted != 1 {
+			t.Errorf("Expected 1 evicted key, got %d", evicted)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestClose(t *testing.T) {
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	for _, algo := range algorithms {
+		for _, metrics := range []bool{false, true} {
+			name := string(algo)
+			if metrics {
+				name += " With Metrics"
+			}
+			t.Run(name, func(t *testing.T) {
+				clock := ratelimiter.NewFakeClock(time.Now())
+				limiter, err := ratelimiter.New(
+					ratelimiter.WithAlgorithm(algo),
+					ratelimiter.WithRate(1),
+					ratelimiter.WithBurst(1),
+					ratelimiter.WithCapacity(1),
+					ratelimiter.WithWindow(time.Hour),
+					ratelimiter.WithClock(clock),
+					ratelimiter.WithMetrics(metrics),
+				)
+				if err != nil {
+					t.Fatalf("Failed to create limiter: %v", err)
+				}
+				closer, ok := limiter.(ratelimiter.Closer)
+				if !ok {
+					t.Fatalf("%s limiter should be a Closer", algo)
+				}
+				limiter.Allow()
+
+				done := make(chan error, 1)
+				go func() { done <- limiter.Wait(context.Background()) }()
+				clock.BlockUntil(1)
+
+				if err := closer.Close(); err != nil {
+					t.Fatalf("Close failed: %v", err)
+				}
+
+				select {
+				case err := <-done:
+					if !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+						t.Errorf("Expected ErrLimiterClosed, got %v", err)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("Close should wake the blocked waiter")
+				}
+				if pending := clock.PendingTimers(); pending != 0 {
+					t.Errorf("Expected the waiter's timer to be stopped, got %d pending", pending)
+				}
+
+				clock.Advance(2 * time.Hour)
+				if limiter.Allow() {
+					t.Error("Allow should fail after Close")
+				}
+				if err := limiter.WaitN(context.Background(), 1); !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+					t.Errorf("Expected ErrLimiterClosed after Close, got %v", err)
+				}
+				if err := closer.Close(); err != nil {
+					t.Errorf("Closing twice should not fail, got %v", err)
+				}
+			})
+		}
+	}
+
+	t.Run("Reserve", func(t *testing.T) {
+		limiter := ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 10, Capacity: 10})
+		if err := limiter.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		if limiter.Reserve().OK() {
+			t.Error("Reserve should fail after Close")
+		}
+	})
+
+	t.Run("Keyed", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Hour),
+		)
+		limiter.AllowKey("a")
+
+		done := make(chan error, 1)
+		go func() { done <- limiter.WaitKey(context.Background(), "a") }()
+		time.Sleep(10 * time.Millisecond)
+		if err := limiter.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+				t.Errorf("Expected ErrLimiterClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Close should wake the blocked waiter")
+		}
+		if limiter.AllowKey("b") {
+			t.Error("New keys should be rejected after Close")
+		}
+		if limiter.Len() != 0 {
+			t.Errorf("Expected no keys after Close, got %d", limiter.Len())
+		}
+	})
+
+	t.Run("Limiter Without Close", func(t *testing.T) {
+		limiter, err := ratelimiter.New(ratelimiter.WithAlgorithm(plainAlgorithm))
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		if _, ok := limiter.(ratelimiter.Closer); ok {
+			t.Error("A limiter without Close should not be a Closer")
+		}
+
+		wrapper := ratelimiter.NewMetricsWrapper(limiter, ratelimiter.NewMetricsCollector())
+		if err := wrapper.Close(); err != nil {
+			t.Errorf("Closing a wrapper of a limiter without Close should not fail, got %v", err)
+		}
+
+		keyed, err := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm(plainAlgorithm),
+			ratelimiter.WithMetrics(false),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create keyed limiter: %v", err)
+		}
+		keyed.AllowKey("a")
+		if err := keyed.Close(); err != nil {
+			t.Errorf("Closing keys without Close should not fail, got %v", err)
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewConcurrency(ratelimiter.WithMaxInFlight(1))
+		release, _ := limiter.Acquire(context.Background())
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := limiter.Acquire(context.Background())
+			done <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		if err := limiter.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		select {
+		case err := <-done:
+			if !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+				t.Errorf("Expected ErrLimiterClosed, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Close should wake the blocked Acquire")
+		}
+		if _, ok := limiter.TryAcquire(); ok {
+			t.Error("TryAcquire should fail after Close")
+		}
+
+		release()
+		if limiter.InFlight() != 0 {
+			t.Errorf("Leases held at Close should still be released, got %d in flight", limiter.InFlight())
+		}
+	})
+}
@@ -0,0 +1,209 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ConcurrencyLimiter caps the number of requests in flight at MaxInFlight.
+// Capacity is taken with Acquire and given back by calling the returned
+// release function. It can optionally also apply a rate limit built by New.
+type ConcurrencyLimiter struct {
+	maxInFlight  int64
+	slots        chan struct{}
+	rate         Limiter
+	inFlight     int64
+	peakInFlight int64
+	lastReset    int64
+	allowedCount int64
+	deniedCount  int64
+	closed       closer
+	waiters      waitQueue
+	clock        Clock
+}
+
+// NewConcurrencyLimiter creates a ConcurrencyLimiter that only limits
+// concurrency. MaxInFlight must be positive; NewConcurrency checks it.
+func NewConcurrencyLimiter(config *Config) *ConcurrencyLimiter {
+	maxInFlight := config.MaxInFlight
+	if maxInFlight < 0 {
+		maxInFlight = 0
+	}
+	clock := config.clockOrDefault()
+	return &ConcurrencyLimiter{
+		maxInFlight: int64(maxInFlight),
+		slots:       make(chan struct{}, maxInFlight),
+		waiters:     newWaitQueue(config.MaxWaiters),
+		lastReset:   clock.Now().UnixNano(),
+		clock:       clock,
+	}
+}
+
+// NewConcurrency creates a ConcurrencyLimiter from options. With WithRateLimited(true)
+// every lease must also be admitted by the limiter New builds from the same options.
+// The options are validated as New validates them, and MaxInFlight must be positive.
+func NewConcurrency(opts ...Option) (*ConcurrencyLimiter, error) {
+	config := DefaultConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	if err := validateConcurrency(config); err != nil {
+		return nil, err
+	}
+
+	cl := NewConcurrencyLimiter(config)
+	if config.RateLimited {
+		rate, err := newLimiter(config)
+		if err != nil {
+			return nil, err
+		}
+		cl.rate = rate
+	}
+	return cl, nil
+}
+
+// validateConcurrency checks config for NewConcurrency, adding MaxInFlight to
+// the fields Validate reports
+func validateConcurrency(config *Config) error {
+	err := config.Validate()
+	if config.MaxInFlight > 0 {
+		return err
+	}
+	field := &FieldError{Field: "MaxInFlight", Value: config.MaxInFlight, Reason: "must be positive"}
+	var configErr *ConfigError
+	switch {
+	case err == nil:
+		return &ConfigError{Algorithm: config.Algorithm, Fields: []*FieldError{field}}
+	case errors.As(err, &configErr):
+		configErr.Fields = append(configErr.Fields, field)
+	}
+	return err
+}
+
+// Acquire blocks until a slot is free (and then until the rate limit, if any,
+// admits the request) and returns the function that gives the slot back.
+// Calling release more than once has no further effect. The slot is taken
+// first, so a caller that gives up waiting for one has not used up the rate limit.
+func (cl *ConcurrencyLimiter) Acquire(ctx context.Context) (release func(), err error) {
+	if cl.closed.isClosed() {
+		return nil, ErrLimiterClosed
+	}
+	if err := cl.takeSlot(ctx); err != nil {
+		atomic.AddInt64(&cl.deniedCount, 1)
+		return nil, err
+	}
+	if cl.rate != nil {
+		if err := cl.rate.Wait(ctx); err != nil {
+			<-cl.slots
+			atomic.AddInt64(&cl.deniedCount, 1)
+			return nil, err
+		}
+	}
+	return cl.lease(), nil
+}
+
+// takeSlot blocks until a slot is free and takes it
+func (cl *ConcurrencyLimiter) takeSlot(ctx context.Context) error {
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if !cl.waiters.enter() {
+		return ErrTooManyWaiters
+	}
+	defer cl.waiters.leave()
+
+	select {
+	case cl.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-cl.closed.done():
+		return ErrLimiterClosed
+	}
+}
+
+// TryAcquire takes a slot only if one is free right now
+func (cl *ConcurrencyLimiter) TryAcquire() (release func(), ok bool) {
+	if cl.closed.isClosed() {
+		return nil, false
+	}
+
+	select {
+	case cl.slots <- struct{}{}:
+	default:
+		atomic.AddInt64(&cl.deniedCount, 1)
+		return nil, false
+	}
+	if cl.rate != nil && !cl.rate.Allow() {
+		<-cl.slots
+		atomic.AddInt64(&cl.deniedCount, 1)
+		return nil, false
+	}
+	return cl.lease(), true
+}
+
+// InFlight returns the number of leases currently held
+func (cl *ConcurrencyLimiter) InFlight() int {
+	return int(atomic.LoadInt64(&cl.inFlight))
+}
+
+// Close wakes every caller blocked in Acquire with ErrLimiterClosed and makes
+// later calls fail. Leases already held can still be released.
+func (cl *ConcurrencyLimiter) Close() error {
+	cl.closed.close()
+	if cl.rate != nil {
+		return closeLimiter(cl.rate)
+	}
+	return nil
+}
+
+// Reset resets the counters and the peak. Leases already held stay valid.
+func (cl *ConcurrencyLimiter) Reset() {
+	atomic.StoreInt64(&cl.peakInFlight, atomic.LoadInt64(&cl.inFlight))
+	atomic.StoreInt64(&cl.lastReset, cl.clock.Now().UnixNano())
+	atomic.StoreInt64(&cl.allowedCount, 0)
+	atomic.StoreInt64(&cl.deniedCount, 0)
+	if cl.rate != nil {
+		cl.rate.Reset()
+	}
+}
+
+func (cl *ConcurrencyLimiter) GetMetrics() Metrics {
+	metrics := Metrics{}
+	if cl.rate != nil {
+		metrics = cl.rate.GetMetrics()
+	}
+	metrics.TotalRequests = atomic.LoadInt64(&cl.allowedCount) + atomic.LoadInt64(&cl.deniedCount)
+	metrics.AllowedRequests = atomic.LoadInt64(&cl.allowedCount)
+	metrics.DeniedRequests = atomic.LoadInt64(&cl.deniedCount)
+	metrics.LastResetTime = atomic.LoadInt64(&cl.lastReset)
+	metrics.InFlight = atomic.LoadInt64(&cl.inFlight)
+	metrics.PeakInFlight = atomic.LoadInt64(&cl.peakInFlight)
+	metrics.MaxInFlight = cl.maxInFlight
+	metrics.QueueDepth += cl.waiters.len()
+	return metrics
+}
+
+func (cl *ConcurrencyLimiter) lease() func() {
+	atomic.AddInt64(&cl.allowedCount, 1)
+	inFlight := atomic.AddInt64(&cl.inFlight, 1)
+	for {
+		peak := atomic.LoadInt64(&cl.peakInFlight)
+		if inFlight <= peak || atomic.CompareAndSwapInt64(&cl.peakInFlight, peak, inFlight) {
+			break
+		}
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			atomic.AddInt64(&cl.inFlight, -1)
+			<-cl.slots
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"github.com/popeskul/ratelimiter"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	t.Run("TryAcquire", func(t *testing.T) {
+		limiter := ratelimiter.NewConcurrencyLimiter(&ratelimiter.Config{MaxInFlight: 2})
+
+		release1, ok := limiter.TryAcquire()
+		if !ok {
+			t.Fatal("First lease should be granted")
+		}
+		if _, ok := limiter.TryAcquire(); !ok {
+			t.Fatal("Second lease should be granted")
+		}
+		if _, ok := limiter.TryAcquire(); ok {
+			t.Error("Third lease should be denied")
+		}
+
+		release1()
+		release1() // releasing twice must not free a second slot
+
+		if _, ok := limiter.TryAcquire(); !ok {
+			t.Error("Lease should be granted after release")
+		}
+		if _, ok := limiter.TryAcquire(); ok {
+			t.Error("Lease should be denied after a double release")
+		}
+	})
+
+	t.Run("Acquire", func(t *testing.T) {
+		limiter := ratelimiter.NewConcurrencyLimiter(&ratelimiter.Config{MaxInFlight: 1})
+
+		release, err := limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Acquire should not error: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := limiter.Acquire(ctx); err == nil {
+			t.Error("Acquire should time out while the slot is held")
+		}
+
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			release()
+		}()
+
+		release, err = limiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("Acquire should succeed after release: %v", err)
+		}
+		release()
+	})
+
+	t.Run("Peak In Flight", func(t *testing.T) {
+		limiter := ratelimiter.NewConcurrencyLimiter(&ratelimiter.Config{MaxInFlight: 5})
+
+		var wg sync.WaitGroup
+		var current, maxSeen int64
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				release, err := limiter.Acquire(context.Background())
+				if err != nil {
+					t.Errorf("Acquire should not error: %v", err)
+					return
+				}
+				n := atomic.AddInt64(&current, 1)
+				for {
+					m := atomic.LoadInt64(&maxSeen)
+					if n <= m || atomic.CompareAndSwapInt64(&maxSeen, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt64(&current, -1)
+				release()
+			}()
+		}
+		wg.Wait()
+
+		if maxSeen > 5 {
+			t.Errorf("Expected at most 5 in flight, saw %d", maxSeen)
+		}
+
+		metrics := limiter.GetMetrics()
+		if metrics.InFlight != 0 {
+			t.Errorf("Expected 0 in flight, got %d", metrics.InFlight)
+		}
+		if metrics.PeakInFlight < 1 || metrics.PeakInFlight > 5 {
+			t.Errorf("Expected peak in flight between 1 and 5, got %d", metrics.PeakInFlight)
+		}
+		if metrics.AllowedRequests != 50 {
+			t.Errorf("Expected 50 allowed requests, got %d", metrics.AllowedRequests)
+		}
+	})
+
+	t.Run("Rate Limited", func(t *testing.T) {
+		limiter, err := ratelimiter.NewConcurrency(
+			ratelimiter.WithMaxInFlight(10),
+			ratelimiter.WithRateLimited(true),
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(2),
+			ratelimiter.WithWindow(time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			release, ok := limiter.TryAcquire()
+			if !ok {
+				t.Fatalf("Lease %d should be granted", i+1)
+			}
+			release()
+		}
+		if _, ok := limiter.TryAcquire(); ok {
+			t.Error("Lease should be denied by the rate limit")
+		}
+
+		metrics := limiter.GetMetrics()
+		if metrics.CurrentRate != 2 {
+			t.Errorf("Expected current rate 2, got %d", metrics.CurrentRate)
+		}
+		if metrics.DeniedRequests != 1 {
+			t.Errorf("Expected 1 denied request, got %d", metrics.DeniedRequests)
+		}
+	})
+	t.Run("Rate Limit After Slot", func(t *testing.T) {
+		limiter, err := ratelimiter.NewConcurrency(
+			ratelimiter.WithMaxInFlight(1),
+			ratelimiter.WithRateLimited(true),
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(2),
+			ratelimiter.WithWindow(time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+
+		release, ok := limiter.TryAcquire()
+		if !ok {
+			t.Fatal("First lease should be granted")
+		}
+		if _, ok := limiter.TryAcquire(); ok {
+			t.Error("Lease should be denied while the only slot is held")
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := limiter.Acquire(ctx); err == nil {
+			t.Error("Acquire should time out while the only slot is held")
+		}
+		release()
+
+		if _, ok := limiter.TryAcquire(); !ok {
+			t.Error("Callers denied a slot should not have used up the rate limit")
+		}
+	})
+}
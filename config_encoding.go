@@ -0,0 +1,240 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jsonDuration encodes a time.Duration as a string such as "1m0s" and decodes
+// either such a string or a number of nanoseconds
+type jsonDuration time.Duration
+
+func (d jsonDuration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *jsonDuration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return fmt.Errorf("%w: duration must be a string such as \"1m\", got %s", ErrInvalidConfig, data)
+		}
+		*d = jsonDuration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	*d = jsonDuration(v)
+	return nil
+}
+
+// MarshalJSON encodes the Config as a JSON object with durations written as
+// strings such as "1m0s". The Clock is left out.
+func (c Config) MarshalJSON() ([]byte, error) {
+	type plain Config
+	return json.Marshal(struct {
+		plain
+		Window      jsonDuration `json:"window"`
+		InnerWindow jsonDuration `json:"inner_window"`
+		KeyTTL      jsonDuration `json:"key_ttl"`
+	}{
+		plain:       plain(c),
+		Window:      jsonDuration(c.Window),
+		InnerWindow: jsonDuration(c.InnerWindow),
+		KeyTTL:      jsonDuration(c.KeyTTL),
+	})
+}
+
+// UnmarshalJSON decodes a JSON object on top of the Config, so fields missing
+// from it keep their value; start from DefaultConfig to get the usual
+// defaults. Durations may be strings such as "1m" or numbers of nanoseconds.
+// A JSON string is read as the compact form accepted by ParseConfig.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return c.parse(s)
+	}
+
+	type plain Config
+	aux := struct {
+		*plain
+		Window      *jsonDuration `json:"window"`
+		InnerWindow *jsonDuration `json:"inner_window"`
+		KeyTTL      *jsonDuration `json:"key_ttl"`
+	}{plain: (*plain)(c)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	if aux.Window != nil {
+		c.Window = time.Duration(*aux.Window)
+	}
+	if aux.InnerWindow != nil {
+		c.InnerWindow = time.Duration(*aux.InnerWindow)
+	}
+	if aux.KeyTTL != nil {
+		c.KeyTTL = time.Duration(*aux.KeyTTL)
+	}
+	return nil
+}
+
+// ParseConfig parses the compact form of a Config, such as
+// "100/m burst=20 algo=sliding_window", on top of DefaultConfig. The rate is
+// written as requests per unit, where the unit is s, m, h, d or any duration
+// such as 10s; it sets both Rate and Window. Token Bucket and Leaky Bucket
+// rates are always per second. The other fields are written as key=value
+// pairs named like their JSON keys, with algo as a short form of algorithm.
+// The result is not validated; call Validate before using it.
+func ParseConfig(s string) (*Config, error) {
+	config := DefaultConfig()
+	if err := config.parse(s); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// parse applies the compact form s to the Config
+func (c *Config) parse(s string) error {
+	rate := ""
+	for _, field := range strings.Fields(s) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			if err := c.parseRate(field); err != nil {
+				return err
+			}
+			rate = field
+			continue
+		}
+
+		var err error
+		switch key {
+		case "burst":
+			c.Burst, err = strconv.Atoi(value)
+		case "capacity":
+			c.Capacity, err = strconv.Atoi(value)
+		case "inner_window":
+			c.InnerWindow, err = time.ParseDuration(value)
+		case "queue_size":
+			c.QueueSize, err = strconv.Atoi(value)
+		case "max_waiters":
+			c.MaxWaiters, err = strconv.Atoi(value)
+		case "max_in_flight":
+			c.MaxInFlight, err = strconv.Atoi(value)
+		case "rate_limited":
+			c.RateLimited, err = strconv.ParseBool(value)
+		case "algo", "algorithm":
+			c.Algorithm = Algorithm(value)
+		case "metrics":
+			c.MetricsEnabled, err = strconv.ParseBool(value)
+		case "key_ttl":
+			c.KeyTTL, err = time.ParseDuration(value)
+		case "max_keys":
+			c.MaxKeys, err = strconv.Atoi(value)
+		case "shards":
+			c.Shards, err = strconv.Atoi(value)
+		default:
+			return fmt.Errorf("%w: unknown key %q", ErrInvalidConfig, key)
+		}
+		if err != nil {
+			return fmt.Errorf("%w: invalid %s %q", ErrInvalidConfig, key, value)
+		}
+	}
+
+	if rate != "" && perSecond(c.Algorithm) && c.Window != time.Second {
+		return fmt.Errorf("%w: %s rate must be per second, got %q", ErrInvalidConfig, c.Algorithm, rate)
+	}
+	return nil
+}
+
+// parseRate parses a rate such as 100/m into Rate and Window
+func (c *Config) parseRate(field string) error {
+	count, unit, ok := strings.Cut(field, "/")
+	if !ok {
+		return fmt.Errorf("%w: expected a rate such as 100/m or a key=value pair, got %q", ErrInvalidConfig, field)
+	}
+	rate, err := strconv.Atoi(count)
+	if err != nil {
+		return fmt.Errorf("%w: invalid rate %q", ErrInvalidConfig, field)
+	}
+
+	var window time.Duration
+	switch unit {
+	case "s":
+		window = time.Second
+	case "m":
+		window = time.Minute
+	case "h":
+		window = time.Hour
+	case "d":
+		window = 24 * time.Hour
+	default:
+		if window, err = time.ParseDuration(unit); err != nil {
+			return fmt.Errorf("%w: invalid rate unit %q", ErrInvalidConfig, field)
+		}
+	}
+
+	c.Rate = rate
+	c.Window = window
+	return nil
+}
+
+// String returns the compact form of the Config that ParseConfig reads back,
+// such as "100/m burst=20 algo=sliding_window". Fields with their default
+// value and the Clock are left out.
+func (c *Config) String() string {
+	defaults := DefaultConfig()
+
+	var b strings.Builder
+	window := c.Window
+	if perSecond(c.Algorithm) {
+		window = time.Second
+	}
+	fmt.Fprintf(&b, "%d/%s", c.Rate, formatUnit(window))
+
+	add := func(key string, value, defaultValue any) {
+		if value != defaultValue {
+			fmt.Fprintf(&b, " %s=%v", key, value)
+		}
+	}
+	add("burst", c.Burst, defaults.Burst)
+	add("capacity", c.Capacity, defaults.Capacity)
+	add("inner_window", c.InnerWindow, defaults.InnerWindow)
+	add("queue_size", c.QueueSize, defaults.QueueSize)
+	add("max_waiters", c.MaxWaiters, defaults.MaxWaiters)
+	add("max_in_flight", c.MaxInFlight, defaults.MaxInFlight)
+	add("rate_limited", c.RateLimited, defaults.RateLimited)
+	add("metrics", c.MetricsEnabled, defaults.MetricsEnabled)
+	add("key_ttl", c.KeyTTL, defaults.KeyTTL)
+	add("max_keys", c.MaxKeys, defaults.MaxKeys)
+	add("shards", c.Shards, defaults.Shards)
+	fmt.Fprintf(&b, " algo=%s", c.Algorithm)
+	return b.String()
+}
+
+// formatUnit writes a window as the rate unit parseRate reads
+func formatUnit(window time.Duration) string {
+	switch window {
+	case time.Second:
+		return "s"
+	case time.Minute:
+		return "m"
+	case time.Hour:
+		return "h"
+	case 24 * time.Hour:
+		return "d"
+	}
+	return window.String()
+}
+
+// perSecond reports whether the algorithm's rate is always per second and ignores Window
+func perSecond(algo Algorithm) bool {
+	return algo == TokenBucketAlgorithm || algo == LeakyBucketAlgorithm
+}
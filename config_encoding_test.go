@@ -0,0 +1,181 @@
+package ratelimiter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestConfigJSON(t *testing.T) {
+	t.Run("Unmarshal On Defaults", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		data := `{"algorithm": "nested_window", "rate": 500, "burst": 20, "window": "1m", "inner_window": "5s", "key_ttl": 600000000000}`
+		if err := json.Unmarshal([]byte(data), config); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+
+		if config.Algorithm != ratelimiter.NestedWindowAlgorithm || config.Rate != 500 || config.Burst != 20 {
+			t.Errorf("Unexpected config %+v", *config)
+		}
+		if config.Window != time.Minute || config.InnerWindow != 5*time.Second {
+			t.Errorf("Expected windows 1m and 5s, got %v and %v", config.Window, config.InnerWindow)
+		}
+		if config.KeyTTL != 10*time.Minute {
+			t.Errorf("Expected numeric durations in nanoseconds, got %v", config.KeyTTL)
+		}
+		if config.Shards != ratelimiter.DefaultConfig().Shards {
+			t.Errorf("Missing fields should keep their default, got shards %d", config.Shards)
+		}
+	})
+
+	t.Run("Round Trip", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		config.Algorithm = ratelimiter.GCRAAlgorithm
+		config.Window = 90 * time.Second
+		config.MetricsEnabled = true
+		config.Clock = ratelimiter.NewFakeClock(time.Unix(0, 0))
+
+		data, err := json.Marshal(config)
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		if !strings.Contains(string(data), `"window":"1m30s"`) {
+			t.Errorf("Expected durations as strings, got %s", data)
+		}
+		if strings.Contains(strings.ToLower(string(data)), "clock") {
+			t.Errorf("Clock should not be encoded, got %s", data)
+		}
+
+		decoded := ratelimiter.DefaultConfig()
+		if err := json.Unmarshal(data, decoded); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		config.Clock = nil
+		if *decoded != *config {
+			t.Errorf("Expected %+v after a round trip, got %+v", *config, *decoded)
+		}
+	})
+
+	t.Run("Compact String", func(t *testing.T) {
+		var limits map[string]*ratelimiter.Config
+		data := `{"api": "100/m burst=20 algo=sliding_window"}`
+		if err := json.Unmarshal([]byte(data), &limits); err != nil {
+			t.Fatalf("Failed to unmarshal: %v", err)
+		}
+		if config := limits["api"]; config.Rate != 100 || config.Window != time.Minute || config.Burst != 20 {
+			t.Errorf("Unexpected config %+v", *config)
+		}
+	})
+
+	t.Run("Invalid Duration", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		err := json.Unmarshal([]byte(`{"window": "soon"}`), config)
+		if !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+	})
+}
+
+func TestParseConfig(t *testing.T) {
+	t.Run("Compact Form", func(t *testing.T) {
+		config, err := ratelimiter.ParseConfig("100/m burst=20 algo=sliding_window")
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		if config.Rate != 100 || config.Window != time.Minute || config.Burst != 20 {
+			t.Errorf("Unexpected config %+v", *config)
+		}
+		if config.Algorithm != ratelimiter.SlidingWindowAlgorithm {
+			t.Errorf("Expected sliding_window, got %s", config.Algorithm)
+		}
+		if config.Shards != ratelimiter.DefaultConfig().Shards {
+			t.Errorf("Missing fields should keep their default, got shards %d", config.Shards)
+		}
+	})
+
+	t.Run("Units", func(t *testing.T) {
+		tests := map[string]time.Duration{
+			"5/s":     time.Second,
+			"5/h":     time.Hour,
+			"5/d":     24 * time.Hour,
+			"5/10s":   10 * time.Second,
+			"5/250ms": 250 * time.Millisecond,
+		}
+		for s, window := range tests {
+			config, err := ratelimiter.ParseConfig(s + " algo=fixed_window")
+			if err != nil {
+				t.Errorf("%s: failed to parse: %v", s, err)
+				continue
+			}
+			if config.Rate != 5 || config.Window != window {
+				t.Errorf("%s: expected 5 per %v, got %d per %v", s, window, config.Rate, config.Window)
+			}
+		}
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		for _, s := range []string{
+			"100",
+			"x/m",
+			"100/fortnight",
+			"100/m colour=blue",
+			"100/m burst=many",
+			"100/m algo=token_bucket",
+		} {
+			if _, err := ratelimiter.ParseConfig(s); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+				t.Errorf("%q: expected ErrInvalidConfig, got %v", s, err)
+			}
+		}
+	})
+
+	t.Run("String Round Trip", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		config.Algorithm = ratelimiter.NestedWindowAlgorithm
+		config.Rate = 1000
+		config.Window = time.Hour
+		config.Burst = 50
+		config.InnerWindow = time.Minute
+		config.KeyTTL = 30 * time.Second
+		config.MetricsEnabled = true
+
+		s := config.String()
+		if want := "1000/h burst=50 inner_window=1m0s metrics=true key_ttl=30s algo=nested_window"; s != want {
+			t.Errorf("Expected %q, got %q", want, s)
+		}
+		parsed, err := ratelimiter.ParseConfig(s)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", s, err)
+		}
+		if *parsed != *config {
+			t.Errorf("Expected %+v after a round trip, got %+v", *config, *parsed)
+		}
+	})
+
+	t.Run("Per Second Algorithms", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		if s := config.String(); s != "100/s algo=token_bucket" {
+			t.Errorf("Expected a per second token bucket rate, got %q", s)
+		}
+		if _, err := ratelimiter.ParseConfig(config.String()); err != nil {
+			t.Errorf("Failed to parse %q: %v", config.String(), err)
+		}
+	})
+
+	t.Run("With Config", func(t *testing.T) {
+		config, err := ratelimiter.ParseConfig("2/s algo=fixed_window")
+		if err != nil {
+			t.Fatalf("Failed to parse: %v", err)
+		}
+		limiter, err := ratelimiter.New(ratelimiter.WithConfig(config), ratelimiter.WithMetrics(true))
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		if !limiter.Allow() || !limiter.Allow() || limiter.Allow() {
+			t.Error("Expected exactly two requests to be allowed")
+		}
+	})
+}
@@ -0,0 +1,41 @@
+package ratelimiter
+
+import "time"
+
+// Scope names the part of a limiter a Decision describes
+type Scope string
+
+const (
+	ScopeInner Scope = "inner" // the inner window of a NestedWindow
+	ScopeOuter Scope = "outer" // the outer window of a NestedWindow
+)
+
+// Decision is the outcome of an admission together with the limiter state it
+// was made against, so response headers and logs can be filled in from the
+// same decision that admitted or denied the request.
+type Decision struct {
+	Allowed    bool
+	Limit      int64         // requests admitted per window, or the bucket size or burst
+	Remaining  int64         // requests that would still be admitted right after this decision
+	ResetAt    time.Time     // when the current window ends or the limiter is back to its full limit; zero if never
+	RetryAfter time.Duration // how long until a denied request could be admitted; InfDuration if never or unknown
+	DeniedBy   Scope         // which window denied the request, for limiters with more than one
+}
+
+// Err returns nil if the request was allowed and a *RateLimitError otherwise
+func (d Decision) Err() error {
+	if d.Allowed {
+		return nil
+	}
+	return &RateLimitError{
+		RetryAfter: d.RetryAfter,
+		Limit:      d.Limit,
+		Remaining:  d.Remaining,
+		ResetAt:    d.ResetAt,
+	}
+}
+
+// closedDecision is the decision of a closed limiter
+func closedDecision() Decision {
+	return Decision{RetryAfter: InfDuration}
+}
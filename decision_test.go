@@ -0,0 +1,183 @@
+package ratelimiter_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestAllowDecision(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	for _, algo := range algorithms {
+		t.Run(string(algo), func(t *testing.T) {
+			clock := ratelimiter.NewFakeClock(start)
+			limiter, err := ratelimiter.New(
+				ratelimiter.WithAlgorithm(algo),
+				ratelimiter.WithRate(2),
+				ratelimiter.WithBurst(2),
+				ratelimiter.WithCapacity(2),
+				ratelimiter.WithWindow(time.Second),
+				ratelimiter.WithClock(clock),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create limiter: %v", err)
+			}
+			admitter := limiter.(ratelimiter.Admitter)
+
+			d := admitter.AllowDecision(1)
+			if !d.Allowed {
+				t.Fatal("First request should be allowed")
+			}
+			if d.Err() != nil {
+				t.Errorf("An allowed decision should have no error, got %v", d.Err())
+			}
+			if d.RetryAfter != 0 {
+				t.Errorf("An allowed decision should not ask to retry, got %v", d.RetryAfter)
+			}
+			if algo != ratelimiter.LeakyBucketAlgorithm && (d.Limit != 2 || d.Remaining != 1) {
+				t.Errorf("Expected a limit of 2 with 1 remaining, got %d and %d", d.Limit, d.Remaining)
+			}
+
+			admitter.AllowDecision(1)
+			d = admitter.AllowDecision(1)
+			if d.Allowed {
+				t.Fatal("Third request should be denied")
+			}
+			if d.Remaining != 0 {
+				t.Errorf("Expected nothing remaining, got %d", d.Remaining)
+			}
+			if d.RetryAfter <= 0 || d.RetryAfter == ratelimiter.InfDuration {
+				t.Errorf("Expected a finite RetryAfter, got %v", d.RetryAfter)
+			}
+			if !d.ResetAt.After(start) {
+				t.Errorf("Expected a reset after %v, got %v", start, d.ResetAt)
+			}
+			if !errors.Is(d.Err(), ratelimiter.ErrRateLimited) {
+				t.Errorf("Expected ErrRateLimited from a denied decision, got %v", d.Err())
+			}
+		})
+	}
+
+	t.Run("Nested Window Scope", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		limiter := ratelimiter.NewNestedWindow(&ratelimiter.Config{
+			Rate:   4,
+			Burst:  2,
+			Window: time.Second,
+			Clock:  clock,
+		})
+
+		limiter.AllowN(2)
+		d := limiter.AllowDecision(1)
+		if d.Allowed || d.DeniedBy != ratelimiter.ScopeInner {
+			t.Fatalf("Expected a denial by the inner window, got %+v", d)
+		}
+		if d.Limit != 2 || d.RetryAfter != 100*time.Millisecond {
+			t.Errorf("Expected the inner limit of 2 and a retry after 100ms, got %d and %v", d.Limit, d.RetryAfter)
+		}
+		if want := start.Add(100 * time.Millisecond); !d.ResetAt.Equal(want) {
+			t.Errorf("Expected the inner window to reset at %v, got %v", want, d.ResetAt)
+		}
+
+		clock.Advance(100 * time.Millisecond)
+		limiter.AllowN(2)
+		clock.Advance(100 * time.Millisecond)
+		d = limiter.AllowDecision(1)
+		if d.Allowed || d.DeniedBy != ratelimiter.ScopeOuter {
+			t.Fatalf("Expected a denial by the outer window, got %+v", d)
+		}
+		if d.Limit != 4 || d.RetryAfter != 800*time.Millisecond {
+			t.Errorf("Expected the outer limit of 4 and a retry after 800ms, got %d and %v", d.Limit, d.RetryAfter)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		for _, algo := range []ratelimiter.Algorithm{ratelimiter.TokenBucketAlgorithm, ratelimiter.GCRAAlgorithm} {
+			t.Run(string(algo), func(t *testing.T) {
+				const n = 500
+				limiter, err := ratelimiter.New(
+					ratelimiter.WithAlgorithm(algo),
+					ratelimiter.WithRate(n),
+					ratelimiter.WithBurst(n),
+					ratelimiter.WithCapacity(n),
+					ratelimiter.WithWindow(time.Second),
+					ratelimiter.WithClock(ratelimiter.NewFakeClock(start)),
+				)
+				if err != nil {
+					t.Fatalf("Failed to create limiter: %v", err)
+				}
+				admitter := limiter.(ratelimiter.Admitter)
+
+				decisions := make([]ratelimiter.Decision, n)
+				var wg sync.WaitGroup
+				for i := range decisions {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						decisions[i] = admitter.AllowDecision(1)
+					}()
+				}
+				wg.Wait()
+
+				// Every admission leaves one less, so each reports a different remainder
+				seen := make(map[int64]bool)
+				for _, d := range decisions {
+					if !d.Allowed {
+						t.Fatalf("Expected every request to be admitted, got %+v", d)
+					}
+					if seen[d.Remaining] {
+						t.Errorf("Remaining %d reported by more than one admission", d.Remaining)
+					}
+					seen[d.Remaining] = true
+				}
+			})
+		}
+	})
+
+	t.Run("Closed", func(t *testing.T) {
+		limiter := ratelimiter.NewGCRA(&ratelimiter.Config{Rate: 10, Burst: 10, Window: time.Second})
+		if err := limiter.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+
+		if d := limiter.AllowDecision(1); d.Allowed || d.RetryAfter != ratelimiter.InfDuration {
+			t.Errorf("A closed limiter should never allow, got %+v", d)
+		}
+	})
+	t.Run("Limiter Without Decisions", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(plainAlgorithm),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Minute),
+			ratelimiter.WithMetrics(true),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		admitter := limiter.(ratelimiter.Admitter)
+
+		if d := admitter.AllowDecision(1); !d.Allowed {
+			t.Fatal("First request should be allowed")
+		}
+		if d := admitter.AllowDecision(1); d.Allowed || d.RetryAfter != ratelimiter.InfDuration {
+			t.Errorf("Expected a denial with an unknown retry time, got %+v", d)
+		}
+		var limitErr *ratelimiter.RateLimitError
+		if err := admitter.Admit(); !errors.As(err, &limitErr) || limitErr.RetryAfter != ratelimiter.InfDuration {
+			t.Errorf("Expected a RateLimitError with an unknown retry time, got %v", err)
+		}
+	})
+}
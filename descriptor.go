@@ -0,0 +1,275 @@
+package ratelimiter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DescriptorConfig is the limit configuration of one domain, modelled on the
+// Envoy rate limit service. Its descriptors form a tree that is walked with the
+// entries of each request descriptor in turn. It has JSON tags matching the
+// Envoy field names:
+//
+//	{"domain": "api", "descriptors": [
+//	  {"key": "remote_address", "rate_limit": {"unit": "second", "requests_per_unit": 10}},
+//	  {"key": "tenant", "value": "acme", "descriptors": [
+//	    {"key": "path", "rate_limit": {"unit": "minute", "requests_per_unit": 600}}
+//	  ]}
+//	]}
+type DescriptorConfig struct {
+	Domain      string           `json:"domain"`
+	Descriptors []DescriptorNode `json:"descriptors"`
+}
+
+// DescriptorNode matches a descriptor entry by key and, if Value is set, by
+// value. A node without a value matches any value, and every distinct value
+// gets its own limit. The RateLimit of the node reached by the last entry of a
+// request descriptor is the one applied.
+type DescriptorNode struct {
+	Key         string           `json:"key"`
+	Value       string           `json:"value,omitempty"`
+	RateLimit   *DescriptorLimit `json:"rate_limit,omitempty"`
+	Descriptors []DescriptorNode `json:"descriptors,omitempty"`
+}
+
+// DescriptorLimit allows RequestsPerUnit requests per Unit, which is one of
+// "second", "minute", "hour" or "day". Unlimited exempts the descriptor from
+// limiting. Algorithm defaults to a fixed window, as in Envoy.
+type DescriptorLimit struct {
+	Unit            string    `json:"unit"`
+	RequestsPerUnit int       `json:"requests_per_unit"`
+	Unlimited       bool      `json:"unlimited,omitempty"`
+	Algorithm       Algorithm `json:"algorithm,omitempty"`
+}
+
+// DescriptorEntry is one key/value pair of a request descriptor
+type DescriptorEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Descriptor is the list of entries describing one aspect of a request, such
+// as [{tenant acme} {path /search}]
+type Descriptor []DescriptorEntry
+
+// Code is the outcome of a descriptor check
+type Code int
+
+const (
+	CodeOK Code = iota
+	CodeOverLimit
+)
+
+func (c Code) String() string {
+	if c == CodeOverLimit {
+		return "OVER_LIMIT"
+	}
+	return "OK"
+}
+
+// DescriptorStatus reports the outcome for one request descriptor
+type DescriptorStatus struct {
+	Code               Code
+	CurrentLimit       *DescriptorLimit // the limit applied; nil if no limit matched
+	LimitRemaining     int64            // requests left in the current unit
+	DurationUntilReset time.Duration    // until the limit is back to full
+}
+
+// DescriptorResponse is the outcome of ShouldRateLimit. OverallCode is
+// CodeOverLimit if any descriptor is over its limit.
+type DescriptorResponse struct {
+	OverallCode Code
+	Statuses    []DescriptorStatus
+}
+
+// DescriptorLimiter evaluates request descriptors against a DescriptorConfig
+type DescriptorLimiter struct {
+	domain string
+	root   *descriptorNode
+	clock  Clock
+}
+
+type descriptorNode struct {
+	limit     *DescriptorLimit
+	limiter   *KeyedLimiter
+	values    map[DescriptorEntry]*descriptorNode
+	wildcards map[string]*descriptorNode
+}
+
+// NewDescriptorLimiter builds a limiter for every rate limit in the tree. The
+// options are applied to each limit's Config before its rate, window and
+// algorithm, so they can set a Clock, metrics or KeyTTL and MaxKeys for the
+// keyed limiters.
+func NewDescriptorLimiter(config *DescriptorConfig, opts ...Option) (*DescriptorLimiter, error) {
+	base := DefaultConfig()
+	for _, opt := range opts {
+		opt(base)
+	}
+
+	dl := &DescriptorLimiter{domain: config.Domain, clock: base.clockOrDefault()}
+	root, err := newDescriptorNode(config.Descriptors, nil, base, config.Domain)
+	if err != nil {
+		return nil, err
+	}
+	dl.root = root
+	return dl, nil
+}
+
+// newDescriptorNode compiles a level of the tree; path names the parent for errors
+func newDescriptorNode(nodes []DescriptorNode, limit *DescriptorLimit, base *Config, path string) (*descriptorNode, error) {
+	n := &descriptorNode{
+		limit:     limit,
+		values:    make(map[DescriptorEntry]*descriptorNode),
+		wildcards: make(map[string]*descriptorNode),
+	}
+	if limit != nil && !limit.Unlimited {
+		config, err := descriptorConfig(limit, base)
+		if err == nil {
+			n.limiter, err = NewKeyedLimiter(WithConfig(config))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ratelimiter: descriptor %s: %w", path, err)
+		}
+	}
+
+	for _, node := range nodes {
+		nodePath := path + "." + node.Key
+		if node.Value != "" {
+			nodePath += "_" + node.Value
+		}
+		child, err := newDescriptorNode(node.Descriptors, node.RateLimit, base, nodePath)
+		if err != nil {
+			return nil, err
+		}
+
+		entry := DescriptorEntry{Key: node.Key, Value: node.Value}
+		_, dupValue := n.values[entry]
+		_, dupKey := n.wildcards[node.Key]
+		if node.Value != "" && dupValue || node.Value == "" && dupKey {
+			return nil, fmt.Errorf("%w: descriptor %s is defined twice", ErrInvalidConfig, nodePath)
+		}
+		if node.Value != "" {
+			n.values[entry] = child
+		} else {
+			n.wildcards[node.Key] = child
+		}
+	}
+	return n, nil
+}
+
+// descriptorConfig builds the Config of a limit on top of base
+func descriptorConfig(limit *DescriptorLimit, base *Config) (*Config, error) {
+	var window time.Duration
+	switch strings.ToLower(limit.Unit) {
+	case "second":
+		window = time.Second
+	case "minute":
+		window = time.Minute
+	case "hour":
+		window = time.Hour
+	case "day":
+		window = 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("%w: unknown unit %q", ErrInvalidConfig, limit.Unit)
+	}
+
+	config := *base
+	config.Algorithm = limit.Algorithm
+	if config.Algorithm == "" {
+		config.Algorithm = FixedWindowAlgorithm
+	}
+	if perSecond(config.Algorithm) && window != time.Second {
+		return nil, fmt.Errorf("%w: %s rate must be per second, got unit %q", ErrInvalidConfig, config.Algorithm, limit.Unit)
+	}
+	config.Rate = limit.RequestsPerUnit
+	config.Window = window
+	config.Burst = limit.RequestsPerUnit
+	config.Capacity = limit.RequestsPerUnit
+	return &config, nil
+}
+
+// ShouldRateLimit counts hits requests against the limit of every descriptor
+// and reports the outcome of each. As in Envoy, every matching limit is
+// counted, even when another descriptor is over its limit. A descriptor that
+// matches no limit is OK. It returns an error if domain is not the configured one.
+func (dl *DescriptorLimiter) ShouldRateLimit(domain string, descriptors []Descriptor, hits int) (*DescriptorResponse, error) {
+	if domain != dl.domain {
+		return nil, fmt.Errorf("ratelimiter: unknown descriptor domain %q", domain)
+	}
+	if hits < 1 {
+		hits = 1
+	}
+
+	resp := &DescriptorResponse{Statuses: make([]DescriptorStatus, len(descriptors))}
+	for i, descriptor := range descriptors {
+		status := dl.check(descriptor, hits)
+		if status.Code == CodeOverLimit {
+			resp.OverallCode = CodeOverLimit
+		}
+		resp.Statuses[i] = status
+	}
+	return resp, nil
+}
+
+// Close closes the limiters of every limit in the tree and returns their
+// errors joined.
+func (dl *DescriptorLimiter) Close() error {
+	return dl.root.close()
+}
+
+func (n *descriptorNode) close() error {
+	var errs []error
+	if n.limiter != nil {
+		errs = append(errs, n.limiter.Close())
+	}
+	for _, child := range n.values {
+		errs = append(errs, child.close())
+	}
+	for _, child := range n.wildcards {
+		errs = append(errs, child.close())
+	}
+	return errors.Join(errs...)
+}
+
+// check counts hits against the limit descriptor resolves to
+func (dl *DescriptorLimiter) check(descriptor Descriptor, hits int) DescriptorStatus {
+	node := dl.root
+	values := make([]string, len(descriptor))
+	for i, entry := range descriptor {
+		next, ok := node.values[entry]
+		if !ok {
+			next, ok = node.wildcards[entry.Key]
+		}
+		if !ok {
+			return DescriptorStatus{Code: CodeOK}
+		}
+		node = next
+		values[i] = entry.Value
+	}
+
+	status := DescriptorStatus{Code: CodeOK, CurrentLimit: node.limit}
+	if node.limiter == nil {
+		return status
+	}
+
+	limiter := node.limiter.Limiter(strings.Join(values, "\x00"))
+	admitter, ok := limiter.(Admitter)
+	if !ok {
+		if !limiter.AllowN(hits) {
+			status.Code = CodeOverLimit
+		}
+		return status
+	}
+
+	d := admitter.AllowDecision(hits)
+	if !d.Allowed {
+		status.Code = CodeOverLimit
+	}
+	status.LimitRemaining = d.Remaining
+	if !d.ResetAt.IsZero() {
+		status.DurationUntilReset = max(d.ResetAt.Sub(dl.clock.Now()), 0)
+	}
+	return status
+}
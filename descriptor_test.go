@@ -0,0 +1,180 @@
+package ratelimiter_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestDescriptorLimiter(t *testing.T) {
+	const config = `{
+		"domain": "api",
+		"descriptors": [
+			{"key": "remote_address", "rate_limit": {"unit": "second", "requests_per_unit": 2}},
+			{"key": "tenant", "value": "acme", "rate_limit": {"unit": "minute", "requests_per_unit": 3},
+			 "descriptors": [
+				{"key": "path", "value": "/health", "rate_limit": {"unit": "second", "unlimited": true}},
+				{"key": "path", "rate_limit": {"unit": "minute", "requests_per_unit": 1, "algorithm": "sliding_window"}}
+			 ]},
+			{"key": "tenant", "descriptors": [
+				{"key": "path", "rate_limit": {"unit": "hour", "requests_per_unit": 1}}
+			]}
+		]
+	}`
+
+	newLimiter := func(t *testing.T) (*ratelimiter.DescriptorLimiter, *ratelimiter.FakeClock) {
+		t.Helper()
+		var dc ratelimiter.DescriptorConfig
+		if err := json.Unmarshal([]byte(config), &dc); err != nil {
+			t.Fatalf("Failed to unmarshal config: %v", err)
+		}
+		clock := ratelimiter.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		dl, err := ratelimiter.NewDescriptorLimiter(&dc, ratelimiter.WithClock(clock))
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := dl.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		})
+		return dl, clock
+	}
+
+	check := func(t *testing.T, dl *ratelimiter.DescriptorLimiter, descriptors ...ratelimiter.Descriptor) *ratelimiter.DescriptorResponse {
+		t.Helper()
+		resp, err := dl.ShouldRateLimit("api", descriptors, 1)
+		if err != nil {
+			t.Fatalf("ShouldRateLimit failed: %v", err)
+		}
+		return resp
+	}
+
+	remote := func(addr string) ratelimiter.Descriptor {
+		return ratelimiter.Descriptor{{Key: "remote_address", Value: addr}}
+	}
+	tenantPath := func(tenant, path string) ratelimiter.Descriptor {
+		return ratelimiter.Descriptor{{Key: "tenant", Value: tenant}, {Key: "path", Value: path}}
+	}
+
+	t.Run("Wildcard Values Are Limited Separately", func(t *testing.T) {
+		dl, clock := newLimiter(t)
+		for i, want := range []ratelimiter.Code{ratelimiter.CodeOK, ratelimiter.CodeOK, ratelimiter.CodeOverLimit} {
+			if got := check(t, dl, remote("10.0.0.1")).OverallCode; got != want {
+				t.Errorf("Request %d: expected %v, got %v", i, want, got)
+			}
+		}
+		if got := check(t, dl, remote("10.0.0.2")).OverallCode; got != ratelimiter.CodeOK {
+			t.Errorf("Another address should have its own limit, got %v", got)
+		}
+
+		clock.Advance(time.Second)
+		if got := check(t, dl, remote("10.0.0.1")).OverallCode; got != ratelimiter.CodeOK {
+			t.Errorf("Expected OK in the next second, got %v", got)
+		}
+	})
+
+	t.Run("Statuses", func(t *testing.T) {
+		dl, clock := newLimiter(t)
+		acme := ratelimiter.Descriptor{{Key: "tenant", Value: "acme"}}
+		check(t, dl, acme)
+		clock.Advance(15 * time.Second)
+
+		status := check(t, dl, acme).Statuses[0]
+		if status.Code != ratelimiter.CodeOK || status.CurrentLimit == nil || status.CurrentLimit.RequestsPerUnit != 3 {
+			t.Fatalf("Unexpected status %+v", status)
+		}
+		if status.LimitRemaining != 1 {
+			t.Errorf("Expected 1 request remaining, got %d", status.LimitRemaining)
+		}
+		if status.DurationUntilReset != 45*time.Second {
+			t.Errorf("Expected the window to reset in 45s, got %v", status.DurationUntilReset)
+		}
+	})
+
+	t.Run("Nested Descriptors", func(t *testing.T) {
+		dl, _ := newLimiter(t)
+
+		resp := check(t, dl, tenantPath("acme", "/search"), tenantPath("acme", "/search"))
+		if resp.OverallCode != ratelimiter.CodeOverLimit {
+			t.Errorf("Expected OVER_LIMIT overall, got %v", resp.OverallCode)
+		}
+		if resp.Statuses[0].Code != ratelimiter.CodeOK || resp.Statuses[1].Code != ratelimiter.CodeOverLimit {
+			t.Errorf("Unexpected statuses %+v", resp.Statuses)
+		}
+		if got := check(t, dl, tenantPath("acme", "/users")).OverallCode; got != ratelimiter.CodeOK {
+			t.Errorf("Another path should have its own limit, got %v", got)
+		}
+
+		for i := 0; i < 10; i++ {
+			status := check(t, dl, tenantPath("acme", "/health")).Statuses[0]
+			if status.Code != ratelimiter.CodeOK || status.CurrentLimit == nil || !status.CurrentLimit.Unlimited {
+				t.Fatalf("Expected the unlimited descriptor to stay OK, got %+v", status)
+			}
+		}
+
+		check(t, dl, tenantPath("other", "/search"))
+		if got := check(t, dl, tenantPath("other", "/search")).OverallCode; got != ratelimiter.CodeOverLimit {
+			t.Errorf("Expected the wildcard tenant limit to apply, got %v", got)
+		}
+	})
+
+	t.Run("No Match", func(t *testing.T) {
+		dl, _ := newLimiter(t)
+		for _, descriptor := range []ratelimiter.Descriptor{
+			{{Key: "user", Value: "1"}},
+			{{Key: "remote_address", Value: "10.0.0.1"}, {Key: "path", Value: "/"}},
+		} {
+			status := check(t, dl, descriptor).Statuses[0]
+			if status.Code != ratelimiter.CodeOK || status.CurrentLimit != nil {
+				t.Errorf("%v: expected OK without a limit, got %+v", descriptor, status)
+			}
+		}
+	})
+
+	t.Run("Hits", func(t *testing.T) {
+		dl, _ := newLimiter(t)
+		resp, err := dl.ShouldRateLimit("api", []ratelimiter.Descriptor{remote("10.0.0.1")}, 3)
+		if err != nil {
+			t.Fatalf("ShouldRateLimit failed: %v", err)
+		}
+		if resp.OverallCode != ratelimiter.CodeOverLimit {
+			t.Errorf("Expected 3 hits to exceed a limit of 2, got %v", resp.OverallCode)
+		}
+	})
+
+	t.Run("Unknown Domain", func(t *testing.T) {
+		dl, _ := newLimiter(t)
+		if _, err := dl.ShouldRateLimit("other", []ratelimiter.Descriptor{remote("10.0.0.1")}, 1); err == nil {
+			t.Error("Expected an error for an unknown domain")
+		}
+	})
+
+	t.Run("Invalid Config", func(t *testing.T) {
+		limit := func(unit string, rate int, algo ratelimiter.Algorithm) *ratelimiter.DescriptorLimit {
+			return &ratelimiter.DescriptorLimit{Unit: unit, RequestsPerUnit: rate, Algorithm: algo}
+		}
+		invalid := map[string][]ratelimiter.DescriptorNode{
+			"unit":       {{Key: "a", RateLimit: limit("fortnight", 1, "")}},
+			"rate":       {{Key: "a", RateLimit: limit("second", 0, "")}},
+			"per-second": {{Key: "a", RateLimit: limit("minute", 1, ratelimiter.TokenBucketAlgorithm)}},
+			"duplicate":  {{Key: "a", Value: "1"}, {Key: "a", Value: "1"}},
+			"nested":     {{Key: "a", Descriptors: []ratelimiter.DescriptorNode{{Key: "b", RateLimit: limit("day", -1, "")}}}},
+		}
+		for name, nodes := range invalid {
+			_, err := ratelimiter.NewDescriptorLimiter(&ratelimiter.DescriptorConfig{Domain: "api", Descriptors: nodes})
+			if !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+				t.Errorf("%s: expected ErrInvalidConfig, got %v", name, err)
+			}
+		}
+	})
+
+	t.Run("Code String", func(t *testing.T) {
+		if ratelimiter.CodeOK.String() != "OK" || ratelimiter.CodeOverLimit.String() != "OVER_LIMIT" {
+			t.Errorf("Unexpected codes %v and %v", ratelimiter.CodeOK, ratelimiter.CodeOverLimit)
+		}
+	})
+}
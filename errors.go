@@ -1,7 +1,62 @@
 package ratelimiter
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrUnsupportedAlgorithm = errors.New("unsupported rate limiting algorithm")
+	ErrQueueFull            = errors.New("rate limiter queue is full")
+	ErrLimiterClosed        = errors.New("rate limiter is closed")
+	ErrTooManyWaiters       = errors.New("rate limiter has too many waiters")
+	ErrExceedsLimit         = errors.New("requested count exceeds the rate limiter's limit")
+	ErrRateLimited          = errors.New("rate limit exceeded")
+	ErrInvalidConfig        = errors.New("invalid rate limiter config")
 )
+
+// RateLimitError is returned by Admit and AdmitN when a request is denied. It
+// tells the caller when to retry and how much of the limit is left, and
+// matches ErrRateLimited with errors.Is.
+type RateLimitError struct {
+	RetryAfter time.Duration // how long until the request could be admitted; InfDuration if never or unknown
+	Limit      int64         // requests admitted per window, or the bucket size or burst
+	Remaining  int64         // requests that would be admitted right now
+	ResetAt    time.Time     // when the current window ends or the limiter is back to its full limit; zero if never
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter == InfDuration {
+		return ErrRateLimited.Error()
+	}
+	return fmt.Sprintf("%v, retry after %v", ErrRateLimited, e.RetryAfter)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// DeadlineError is returned by Wait and WaitN when the request cannot be
+// admitted before the context deadline. It is returned right away instead of
+// waiting for the deadline, and matches context.DeadlineExceeded with errors.Is.
+type DeadlineError struct {
+	Delay time.Duration // how long the request would have had to wait
+}
+
+func (e *DeadlineError) Error() string {
+	return fmt.Sprintf("rate limiter wait of %v exceeds the context deadline", e.Delay)
+}
+
+func (e *DeadlineError) Unwrap() error {
+	return context.DeadlineExceeded
+}
+
+// checkDeadline returns a *DeadlineError if ctx ends less than delay after now
+func checkDeadline(ctx context.Context, now time.Time, delay time.Duration) error {
+	if deadline, ok := ctx.Deadline(); ok && delay > deadline.Sub(now) {
+		return &DeadlineError{Delay: delay}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestWaitDeadline(t *testing.T) {
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	newLimiter := func(t *testing.T, algo ratelimiter.Algorithm) ratelimiter.Limiter {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(algo),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithBurst(1),
+			ratelimiter.WithCapacity(1),
+			ratelimiter.WithWindow(2*time.Second),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		return limiter
+	}
+
+	for _, algo := range algorithms {
+		t.Run(string(algo)+" Fails Fast", func(t *testing.T) {
+			limiter := newLimiter(t, algo)
+			limiter.Allow()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			start := time.Now()
+			err := limiter.WaitN(ctx, 1)
+			if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+				t.Errorf("WaitN should return right away, took %v", elapsed)
+			}
+
+			var deadlineErr *ratelimiter.DeadlineError
+			if !errors.As(err, &deadlineErr) {
+				t.Fatalf("Expected a DeadlineError, got %v", err)
+			}
+			if deadlineErr.Delay <= 100*time.Millisecond {
+				t.Errorf("Expected the required delay to exceed the deadline, got %v", deadlineErr.Delay)
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Error("DeadlineError should match context.DeadlineExceeded")
+			}
+		})
+
+		if algo == ratelimiter.LeakyBucketAlgorithm {
+			// A leaky bucket spreads any N over consecutive slots, so no N is too large
+			continue
+		}
+
+		t.Run(string(algo)+" Rejects N Above Limit", func(t *testing.T) {
+			limiter := newLimiter(t, algo)
+
+			done := make(chan error, 1)
+			go func() { done <- limiter.WaitN(context.Background(), 2) }()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, ratelimiter.ErrExceedsLimit) {
+					t.Errorf("Expected ErrExceedsLimit, got %v", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("WaitN with N above the limit should not block")
+			}
+		})
+	}
+
+	t.Run("Waits Within Deadline", func(t *testing.T) {
+		limiter := ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 20, Capacity: 1})
+		limiter.Allow()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		if err := limiter.Wait(ctx); err != nil {
+			t.Errorf("Wait should succeed when the delay fits the deadline, got %v", err)
+		}
+	})
+}
+
+func TestAdmit(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	for _, algo := range algorithms {
+		for _, metrics := range []bool{false, true} {
+			name := string(algo)
+			if metrics {
+				name += " With Metrics"
+			}
+			t.Run(name, func(t *testing.T) {
+				clock := ratelimiter.NewFakeClock(start)
+				limiter, err := ratelimiter.New(
+					ratelimiter.WithAlgorithm(algo),
+					ratelimiter.WithRate(2),
+					ratelimiter.WithBurst(2),
+					ratelimiter.WithCapacity(2),
+					ratelimiter.WithWindow(time.Second),
+					ratelimiter.WithClock(clock),
+					ratelimiter.WithMetrics(metrics),
+				)
+				if err != nil {
+					t.Fatalf("Failed to create limiter: %v", err)
+				}
+				admitter := limiter.(ratelimiter.Admitter)
+
+				if err := admitter.AdmitN(2); err != nil {
+					t.Fatalf("First requests should be admitted, got %v", err)
+				}
+
+				err = admitter.Admit()
+				if !errors.Is(err, ratelimiter.ErrRateLimited) {
+					t.Fatalf("Expected ErrRateLimited, got %v", err)
+				}
+				var limitErr *ratelimiter.RateLimitError
+				if !errors.As(err, &limitErr) {
+					t.Fatalf("Expected a RateLimitError, got %T", err)
+				}
+				if limitErr.Limit != 2 {
+					t.Errorf("Expected a limit of 2, got %d", limitErr.Limit)
+				}
+				if limitErr.Remaining != 0 {
+					t.Errorf("Expected nothing remaining, got %d", limitErr.Remaining)
+				}
+				if limitErr.RetryAfter <= 0 || limitErr.RetryAfter > 2*time.Second {
+					t.Errorf("Expected to retry within 2s, got %v", limitErr.RetryAfter)
+				}
+				if !limitErr.ResetAt.After(start) {
+					t.Errorf("Expected a reset after %v, got %v", start, limitErr.ResetAt)
+				}
+
+				clock.Advance(limitErr.RetryAfter)
+				if err := admitter.Admit(); err != nil {
+					t.Errorf("Request should be admitted after RetryAfter, got %v", err)
+				}
+
+				if err := limiter.(ratelimiter.Closer).Close(); err != nil {
+					t.Fatalf("Close failed: %v", err)
+				}
+				if err := admitter.Admit(); !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+					t.Errorf("Expected ErrLimiterClosed after Close, got %v", err)
+				}
+			})
+		}
+	}
+
+	t.Run("Never Admitted", func(t *testing.T) {
+		limiter := ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 2, Window: time.Second})
+
+		var limitErr *ratelimiter.RateLimitError
+		if !errors.As(limiter.AdmitN(3), &limitErr) {
+			t.Fatal("Expected a RateLimitError")
+		}
+		if limitErr.RetryAfter != ratelimiter.InfDuration {
+			t.Errorf("Expected RetryAfter to be InfDuration, got %v", limitErr.RetryAfter)
+		}
+	})
+
+	t.Run("Exact Values", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		limiter := ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 10, Capacity: 5, Clock: clock})
+		limiter.AllowN(5)
+
+		var limitErr *ratelimiter.RateLimitError
+		if !errors.As(limiter.AdmitN(2), &limitErr) {
+			t.Fatal("Expected a RateLimitError")
+		}
+		if limitErr.RetryAfter != 200*time.Millisecond {
+			t.Errorf("Expected to retry after 200ms, got %v", limitErr.RetryAfter)
+		}
+		if want := start.Add(500 * time.Millisecond); !limitErr.ResetAt.Equal(want) {
+			t.Errorf("Expected the bucket to be full at %v, got %v", want, limitErr.ResetAt)
+		}
+		if limitErr.Error() != "rate limit exceeded, retry after 200ms" {
+			t.Errorf("Unexpected message %q", limitErr.Error())
+		}
+	})
+}
@@ -2,6 +2,7 @@ package ratelimiter
 
 import (
 	"context"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -9,18 +10,24 @@ import (
 type FixedWindow struct {
 	rate         int64
 	window       time.Duration
-	count        int64
-	windowStart  int64
+	counter      windowCounter
 	allowedCount int64
 	deniedCount  int64
+	changed      notifier
+	closed       closer
+	waiters      waitQueue
+	clock        Clock
+	mu           sync.Mutex
 }
 
 func NewFixedWindow(config *Config) *FixedWindow {
+	clock := config.clockOrDefault()
 	return &FixedWindow{
-		rate:        int64(config.Rate),
-		window:      config.Window,
-		count:       0,
-		windowStart: time.Now().UnixNano(),
+		rate:    int64(config.Rate),
+		window:  config.Window,
+		counter: newWindowCounter(config.Window, clock.Now().UnixNano()),
+		clock:   clock,
+		waiters: newWaitQueue(config.MaxWaiters),
 	}
 }
 
@@ -29,23 +36,51 @@ func (fw *FixedWindow) Allow() bool {
 }
 
 func (fw *FixedWindow) AllowN(n int) bool {
-	now := time.Now().UnixNano()
-	windowStart := atomic.LoadInt64(&fw.windowStart)
+	return fw.AllowDecision(n).Allowed
+}
 
-	if now-windowStart >= fw.window.Nanoseconds() {
-		atomic.StoreInt64(&fw.count, 0)
-		atomic.StoreInt64(&fw.windowStart, now)
-		// Удалено неэффективное присваивание windowStart = now
+// AllowDecision admits N requests if the current window has room for them
+func (fw *FixedWindow) AllowDecision(n int) Decision {
+	if fw.closed.isClosed() {
+		return closedDecision()
 	}
 
-	count := atomic.AddInt64(&fw.count, int64(n))
-	if count <= fw.rate {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	now := fw.clock.Now().UnixNano()
+	fw.counter.advance(now)
+
+	d := Decision{
+		Limit:   fw.rate,
+		ResetAt: time.Unix(0, fw.counter.start+fw.counter.window),
+	}
+	switch {
+	case fw.counter.count+int64(n) <= fw.rate:
+		fw.counter.count += int64(n)
 		atomic.AddInt64(&fw.allowedCount, 1)
-		return true
+		d.Allowed = true
+	case int64(n) > fw.rate:
+		atomic.AddInt64(&fw.deniedCount, 1)
+		d.RetryAfter = InfDuration
+	default:
+		atomic.AddInt64(&fw.deniedCount, 1)
+		d.RetryAfter = fw.counter.untilNext(now)
+	}
+	d.Remaining = max(fw.rate-fw.counter.count, 0)
+	return d
+}
+
+func (fw *FixedWindow) Admit() error {
+	return fw.AdmitN(1)
+}
+
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (fw *FixedWindow) AdmitN(n int) error {
+	if fw.closed.isClosed() {
+		return ErrLimiterClosed
 	}
-	atomic.AddInt64(&fw.deniedCount, 1)
-	atomic.AddInt64(&fw.count, -int64(n)) // Rollback the count increase
-	return false
+	return fw.AllowDecision(n).Err()
 }
 
 func (fw *FixedWindow) Wait(ctx context.Context) error {
@@ -53,47 +88,169 @@ func (fw *FixedWindow) Wait(ctx context.Context) error {
 }
 
 func (fw *FixedWindow) WaitN(ctx context.Context, n int) error {
+	waiting := false
 	for {
+		if fw.closed.isClosed() {
+			return ErrLimiterClosed
+		}
 		if fw.AllowN(n) {
 			return nil
 		}
 
+		delay, err := fw.timeToAllow(n)
+		if err == nil {
+			err = checkDeadline(ctx, fw.clock.Now(), delay)
+		}
+		if err != nil {
+			return err
+		}
+		if !waiting {
+			if !fw.waiters.enter() {
+				return ErrTooManyWaiters
+			}
+			defer fw.waiters.leave()
+			waiting = true
+		}
+
+		timer := fw.clock.NewTimer(delay)
 		select {
-		case <-time.After(fw.timeToNextWindow()):
+		case <-timer.C():
+		case <-fw.changed.wait():
+			timer.Stop()
 		case <-ctx.Done():
+			timer.Stop()
 			return ctx.Err()
+		case <-fw.closed.done():
+			timer.Stop()
+			return ErrLimiterClosed
 		}
 	}
 }
 
+func (fw *FixedWindow) Reserve() *Reservation {
+	return fw.ReserveN(1)
+}
+
+// ReserveN reserves N requests in the earliest window, current or future, that
+// still has room for them. N larger than the rate can never be satisfied.
+func (fw *FixedWindow) ReserveN(n int) *Reservation {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if fw.closed.isClosed() {
+		return &Reservation{}
+	}
+	if int64(n) > fw.rate {
+		atomic.AddInt64(&fw.deniedCount, 1)
+		return &Reservation{}
+	}
+
+	now := fw.clock.Now()
+	fw.counter.advance(now.UnixNano())
+
+	start := fw.counter.start
+	for fw.counter.used(start)+int64(n) > fw.rate {
+		start = fw.counter.after(start, int64(n), fw.rate)
+	}
+	fw.counter.add(start, int64(n))
+	atomic.AddInt64(&fw.allowedCount, 1)
+
+	timeToAct := now
+	if start > fw.counter.start {
+		timeToAct = time.Unix(0, start)
+	}
+	return newReservation(fw.clock, n, timeToAct, func(tokens int) {
+		fw.mu.Lock()
+		defer fw.mu.Unlock()
+		fw.counter.advance(fw.clock.Now().UnixNano())
+		if tokens < 0 {
+			fw.counter.add(start, int64(tokens))
+		} else {
+			fw.counter.charge(start, int64(tokens), fw.rate)
+		}
+	})
+}
+
 func (fw *FixedWindow) Reset() {
-	atomic.StoreInt64(&fw.count, 0)
-	atomic.StoreInt64(&fw.windowStart, time.Now().UnixNano())
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	fw.counter.reset(fw.clock.Now().UnixNano())
 	atomic.StoreInt64(&fw.allowedCount, 0)
 	atomic.StoreInt64(&fw.deniedCount, 0)
 }
 
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (fw *FixedWindow) Close() error {
+	fw.closed.close()
+	return nil
+}
+
+// SetRate changes the number of requests allowed per window. Requests already
+// counted in the current window are kept.
+func (fw *FixedWindow) SetRate(rate int) {
+	fw.mu.Lock()
+	fw.rate = int64(rate)
+	fw.mu.Unlock()
+	fw.changed.notify()
+}
+
+// SetBurst has no effect on a FixedWindow
+func (fw *FixedWindow) SetBurst(int) {}
+
+// SetCapacity has no effect on a FixedWindow
+func (fw *FixedWindow) SetCapacity(int) {}
+
+// SetWindow changes the window length. The current window keeps its start and
+// count, so it ends earlier or later according to the new length.
+func (fw *FixedWindow) SetWindow(window time.Duration) {
+	fw.mu.Lock()
+	fw.window = window
+	fw.counter.resize(window)
+	fw.mu.Unlock()
+	fw.changed.notify()
+}
+
 func (fw *FixedWindow) GetMetrics() Metrics {
+	fw.mu.Lock()
+	fw.counter.advance(fw.clock.Now().UnixNano())
+	windowStart := fw.counter.start
+	rate := fw.rate
+	window := fw.window
+	remaining := rate - fw.counter.count
+	fw.mu.Unlock()
+
 	return Metrics{
 		TotalRequests:   atomic.LoadInt64(&fw.allowedCount) + atomic.LoadInt64(&fw.deniedCount),
 		AllowedRequests: atomic.LoadInt64(&fw.allowedCount),
 		DeniedRequests:  atomic.LoadInt64(&fw.deniedCount),
-		CurrentRate:     atomic.LoadInt64(&fw.rate),
-		LastResetTime:   atomic.LoadInt64(&fw.windowStart),
+		CurrentRate:     rate,
+		LastResetTime:   windowStart,
 		TotalWaitTime:   0, // FixedWindow doesn't track wait time
 		MaxWaitTime:     0, // FixedWindow doesn't track max wait time
-		WindowDuration:  fw.window,
+		WindowDuration:  window,
 		InnerRate:       0, // Not applicable for FixedWindow
 		InnerWindow:     0, // Not applicable for FixedWindow
+		Remaining:       remaining,
+		QueueDepth:      fw.waiters.len(),
 	}
 }
 
-func (fw *FixedWindow) timeToNextWindow() time.Duration {
-	now := time.Now().UnixNano()
-	windowStart := atomic.LoadInt64(&fw.windowStart)
-	elapsed := time.Duration(now - windowStart)
+// timeToAllow returns how long until the next window, the earliest that N
+// requests may fit. It returns ErrExceedsLimit if N never fits in a window.
+func (fw *FixedWindow) timeToAllow(n int) (time.Duration, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	if int64(n) > fw.rate {
+		return 0, ErrExceedsLimit
+	}
+
+	now := fw.clock.Now().UnixNano()
+	elapsed := time.Duration(now - fw.counter.start)
 	if elapsed >= fw.window {
-		return 0
+		return 0, nil
 	}
-	return fw.window - elapsed
+	return fw.window - elapsed, nil
 }
@@ -0,0 +1,290 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// GCRA implements the Generic Cell Rate Algorithm. Requests are spaced by an
+// emission interval of Window/Rate and up to Burst requests may arrive at once.
+// The whole state is a single theoretical arrival time (TAT).
+type GCRA struct {
+	rate         int64
+	window       int64 // in nanoseconds
+	burst        int64
+	interval     int64 // emission interval in nanoseconds
+	tat          int64 // theoretical arrival time in unix nanoseconds
+	lastReset    int64
+	allowedCount int64
+	deniedCount  int64
+	changed      notifier
+	closed       closer
+	waiters      waitQueue
+	clock        Clock
+	mu           sync.Mutex // serializes setters
+}
+
+func NewGCRA(config *Config) *GCRA {
+	clock := config.clockOrDefault()
+	now := clock.Now().UnixNano()
+	return &GCRA{
+		rate:      int64(config.Rate),
+		window:    config.Window.Nanoseconds(),
+		burst:     gcraBurst(config.Burst),
+		interval:  gcraInterval(config.Rate, config.Window),
+		tat:       now,
+		lastReset: now,
+		clock:     clock,
+		waiters:   newWaitQueue(config.MaxWaiters),
+	}
+}
+
+func gcraBurst(burst int) int64 {
+	return max(int64(burst), 1)
+}
+
+func gcraInterval(rate int, window time.Duration) int64 {
+	if rate > 0 {
+		return window.Nanoseconds() / int64(rate)
+	}
+	return window.Nanoseconds()
+}
+
+func (g *GCRA) Allow() bool {
+	return g.AllowN(1)
+}
+
+func (g *GCRA) AllowN(n int) bool {
+	return g.AllowDecision(n).Allowed
+}
+
+// AllowDecision admits N requests if they stay within the burst tolerance.
+// The state reported is the TAT the admission left, or found if it was denied.
+func (g *GCRA) AllowDecision(n int) Decision {
+	if g.closed.isClosed() {
+		return closedDecision()
+	}
+
+	now := g.clock.Now().UnixNano()
+	t := g.take(now, n)
+	d := Decision{
+		Allowed:   t.ok,
+		Limit:     t.burst,
+		Remaining: max(gcraRemaining(now, t.tat, t.interval, t.burst), 0),
+		ResetAt:   time.Unix(0, max(t.tat, now)),
+	}
+	switch {
+	case t.ok:
+		atomic.AddInt64(&g.allowedCount, 1)
+	case int64(n) > d.Limit:
+		atomic.AddInt64(&g.deniedCount, 1)
+		d.RetryAfter = InfDuration
+	default:
+		atomic.AddInt64(&g.deniedCount, 1)
+		d.RetryAfter = t.delay
+	}
+	return d
+}
+
+func (g *GCRA) Admit() error {
+	return g.AdmitN(1)
+}
+
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (g *GCRA) AdmitN(n int) error {
+	if g.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	return g.AllowDecision(n).Err()
+}
+
+func (g *GCRA) Wait(ctx context.Context) error {
+	return g.WaitN(ctx, 1)
+}
+
+func (g *GCRA) WaitN(ctx context.Context, n int) error {
+	waiting := false
+	for {
+		if g.closed.isClosed() {
+			return ErrLimiterClosed
+		}
+		if int64(n) > atomic.LoadInt64(&g.burst) {
+			atomic.AddInt64(&g.deniedCount, 1)
+			return ErrExceedsLimit
+		}
+
+		now := g.clock.Now()
+		t := g.take(now.UnixNano(), n)
+		if t.ok {
+			atomic.AddInt64(&g.allowedCount, 1)
+			return nil
+		}
+		delay := t.delay
+
+		if err := checkDeadline(ctx, now, delay); err != nil {
+			atomic.AddInt64(&g.deniedCount, 1)
+			return err
+		}
+
+		if !waiting {
+			if !g.waiters.enter() {
+				atomic.AddInt64(&g.deniedCount, 1)
+				return ErrTooManyWaiters
+			}
+			defer g.waiters.leave()
+			waiting = true
+		}
+
+		timer := g.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-g.changed.wait():
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			atomic.AddInt64(&g.deniedCount, 1)
+			return ctx.Err()
+		case <-g.closed.done():
+			timer.Stop()
+			atomic.AddInt64(&g.deniedCount, 1)
+			return ErrLimiterClosed
+		}
+	}
+}
+
+func (g *GCRA) Reset() {
+	now := g.clock.Now().UnixNano()
+	atomic.StoreInt64(&g.tat, now)
+	atomic.StoreInt64(&g.lastReset, now)
+	atomic.StoreInt64(&g.allowedCount, 0)
+	atomic.StoreInt64(&g.deniedCount, 0)
+}
+
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (g *GCRA) Close() error {
+	g.closed.close()
+	return nil
+}
+
+// SetRate changes the number of requests allowed per window. Requests already
+// accounted for in the TAT keep counting against the new rate.
+func (g *GCRA) SetRate(rate int) {
+	g.mu.Lock()
+	atomic.StoreInt64(&g.rate, int64(rate))
+	g.setInterval(gcraInterval(rate, time.Duration(atomic.LoadInt64(&g.window))))
+	g.mu.Unlock()
+	g.changed.notify()
+}
+
+// SetBurst changes the number of requests that may arrive at once
+func (g *GCRA) SetBurst(burst int) {
+	atomic.StoreInt64(&g.burst, gcraBurst(burst))
+	g.changed.notify()
+}
+
+// SetCapacity has no effect on GCRA; its burst is set with SetBurst
+func (g *GCRA) SetCapacity(int) {}
+
+// SetWindow changes the window the rate applies to
+func (g *GCRA) SetWindow(window time.Duration) {
+	g.mu.Lock()
+	atomic.StoreInt64(&g.window, window.Nanoseconds())
+	g.setInterval(gcraInterval(int(atomic.LoadInt64(&g.rate)), window))
+	g.mu.Unlock()
+	g.changed.notify()
+}
+
+// setInterval changes the emission interval, rescaling the backlog held in
+// the TAT so it still accounts for the same number of requests; the caller holds g.mu
+func (g *GCRA) setInterval(interval int64) {
+	oldInterval := atomic.SwapInt64(&g.interval, interval)
+	now := g.clock.Now().UnixNano()
+	for {
+		tat := atomic.LoadInt64(&g.tat)
+		if tat <= now || oldInterval <= 0 {
+			return
+		}
+		backlog := int64(float64(tat-now) * float64(interval) / float64(oldInterval))
+		if atomic.CompareAndSwapInt64(&g.tat, tat, now+backlog) {
+			return
+		}
+	}
+}
+
+func (g *GCRA) GetMetrics() Metrics {
+	return Metrics{
+		TotalRequests:   atomic.LoadInt64(&g.allowedCount) + atomic.LoadInt64(&g.deniedCount),
+		AllowedRequests: atomic.LoadInt64(&g.allowedCount),
+		DeniedRequests:  atomic.LoadInt64(&g.deniedCount),
+		CurrentRate:     atomic.LoadInt64(&g.rate),
+		LastResetTime:   atomic.LoadInt64(&g.lastReset),
+		TotalWaitTime:   0, // GCRA doesn't track wait time
+		MaxWaitTime:     0, // GCRA doesn't track max wait time
+		WindowDuration:  time.Duration(atomic.LoadInt64(&g.window)),
+		InnerRate:       0, // Not applicable for GCRA
+		InnerWindow:     0, // Not applicable for GCRA
+		Remaining:       g.remaining(g.clock.Now().UnixNano()),
+		QueueDepth:      g.waiters.len(),
+	}
+}
+
+// remaining returns how many requests would be allowed at now
+func (g *GCRA) remaining(now int64) int64 {
+	return gcraRemaining(now, atomic.LoadInt64(&g.tat), atomic.LoadInt64(&g.interval), atomic.LoadInt64(&g.burst))
+}
+
+// gcraRemaining returns how many requests a TAT leaves room for at now
+func gcraRemaining(now, tat, interval, burst int64) int64 {
+	if interval <= 0 {
+		return burst
+	}
+	tat = max(tat, now)
+	return (burst*interval - (tat - now)) / interval
+}
+
+// RetryAfter returns how long until N requests would be allowed
+func (g *GCRA) RetryAfter(n int) time.Duration {
+	now := g.clock.Now().UnixNano()
+	tat := atomic.LoadInt64(&g.tat)
+	if tat < now {
+		tat = now
+	}
+	interval := atomic.LoadInt64(&g.interval)
+	delay := tat + int64(n)*interval - atomic.LoadInt64(&g.burst)*interval - now
+	if delay < 0 {
+		return 0
+	}
+	return time.Duration(delay)
+}
+
+// gcraTake is the outcome of take, with the parameters it was decided by
+type gcraTake struct {
+	tat      int64 // the TAT the admission left, or found if it was denied
+	interval int64
+	burst    int64
+	delay    time.Duration // time until the admission would succeed, if denied
+	ok       bool
+}
+
+// take advances the TAT by N emission intervals if the result stays within the
+// burst tolerance; otherwise it reports the exact time until it would
+func (g *GCRA) take(now int64, n int) gcraTake {
+	t := gcraTake{interval: atomic.LoadInt64(&g.interval), burst: atomic.LoadInt64(&g.burst)}
+	limit := t.burst * t.interval
+	for {
+		t.tat = atomic.LoadInt64(&g.tat)
+		newTAT := max(t.tat, now) + int64(n)*t.interval
+		if newTAT-now > limit {
+			t.delay = time.Duration(newTAT - limit - now)
+			return t
+		}
+		if atomic.CompareAndSwapInt64(&g.tat, t.tat, newTAT) {
+			t.tat = newTAT
+			t.ok = true
+			return t
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"github.com/popeskul/ratelimiter"
+	"testing"
+	"time"
+)
+
+func TestGCRA(t *testing.T) {
+	t.Run("Basic Allow", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(ratelimiter.GCRAAlgorithm),
+			ratelimiter.WithRate(10),
+			ratelimiter.WithBurst(5),
+			ratelimiter.WithWindow(time.Second),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+
+		for i := 0; i < 5; i++ {
+			if !limiter.Allow() {
+				t.Errorf("Request %d should be allowed", i+1)
+			}
+		}
+
+		if limiter.Allow() {
+			t.Error("Request beyond burst should be denied")
+		}
+	})
+
+	t.Run("AllowN", func(t *testing.T) {
+		limiter := ratelimiter.NewGCRA(&ratelimiter.Config{
+			Rate:   10,
+			Burst:  5,
+			Window: time.Second,
+		})
+
+		if !limiter.AllowN(3) {
+			t.Error("AllowN(3) should be allowed")
+		}
+		if limiter.AllowN(3) {
+			t.Error("AllowN(3) should be denied with only 2 remaining")
+		}
+		if !limiter.AllowN(2) {
+			t.Error("AllowN(2) should be allowed")
+		}
+	})
+
+	t.Run("RetryAfter", func(t *testing.T) {
+		limiter := ratelimiter.NewGCRA(&ratelimiter.Config{
+			Rate:   10,
+			Burst:  1,
+			Window: time.Second,
+		})
+
+		if d := limiter.RetryAfter(1); d != 0 {
+			t.Errorf("Expected no delay before the first request, got %v", d)
+		}
+
+		limiter.Allow()
+
+		d := limiter.RetryAfter(1)
+		if d < 90*time.Millisecond || d > 100*time.Millisecond {
+			t.Errorf("Expected a delay of about 100ms, got %v", d)
+		}
+	})
+
+	t.Run("Wait", func(t *testing.T) {
+		limiter := ratelimiter.NewGCRA(&ratelimiter.Config{
+			Rate:   10,
+			Burst:  1,
+			Window: time.Second,
+		})
+
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Errorf("First Wait should not error: %v", err)
+		}
+
+		start := time.Now()
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Errorf("Second Wait should not error: %v", err)
+		}
+		if duration := time.Since(start); duration < 90*time.Millisecond {
+			t.Errorf("Expected to wait at least 90ms, but waited %v", duration)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := limiter.WaitN(ctx, 1); err == nil {
+			t.Error("WaitN should time out")
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		limiter := ratelimiter.NewGCRA(&ratelimiter.Config{
+			Rate:   10,
+			Burst:  2,
+			Window: time.Second,
+		})
+
+		limiter.AllowN(2)
+		if limiter.Allow() {
+			t.Error("Request should be denied before reset")
+		}
+
+		limiter.Reset()
+
+		if !limiter.AllowN(2) {
+			t.Error("AllowN(2) should be allowed after reset")
+		}
+	})
+
+	t.Run("GetMetrics", func(t *testing.T) {
+		limiter := ratelimiter.NewGCRA(&ratelimiter.Config{
+			Rate:   10,
+			Burst:  10,
+			Window: time.Second,
+		})
+
+		for i := 0; i < 15; i++ {
+			limiter.Allow()
+		}
+
+		metrics := limiter.GetMetrics()
+
+		if metrics.TotalRequests != 15 {
+			t.Errorf("Expected 15 total requests, got %d", metrics.TotalRequests)
+		}
+		if metrics.AllowedRequests != 10 {
+			t.Errorf("Expected 10 allowed requests, got %d", metrics.AllowedRequests)
+		}
+		if metrics.DeniedRequests != 5 {
+			t.Errorf("Expected 5 denied requests, got %d", metrics.DeniedRequests)
+		}
+		if metrics.CurrentRate != 10 {
+			t.Errorf("Expected current rate 10, got %d", metrics.CurrentRate)
+		}
+		if metrics.WindowDuration != time.Second {
+			t.Errorf("Expected window duration 1s, got %v", metrics.WindowDuration)
+		}
+	})
+}
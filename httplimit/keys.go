@@ -0,0 +1,216 @@
+package httplimit
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// IPOption configures ClientIP
+type IPOption func(*ipResolver)
+
+// WithTrustedProxies sets the networks of the proxies and load balancers in
+// front of the server. Forwarding headers are only believed from them.
+func WithTrustedProxies(prefixes ...netip.Prefix) IPOption {
+	return func(ir *ipResolver) {
+		ir.trusted = append(ir.trusted, prefixes...)
+	}
+}
+
+// WithForwardedHeader sets the header the trusted proxies record the client
+// address in, X-Forwarded-For by default. It may also be Forwarded, whose for=
+// parameters are read, or a single address header such as X-Real-IP. Only this
+// header is read: the proxies pass other forwarding headers through from the
+// client untouched.
+func WithForwardedHeader(name string) IPOption {
+	return func(ir *ipResolver) {
+		ir.header = http.CanonicalHeaderKey(name)
+	}
+}
+
+// WithIPv6Prefix sets the prefix length IPv6 clients are aggregated to, 64 by
+// default since a single host usually controls a whole /64. Use 128 to key by
+// the full address.
+func WithIPv6Prefix(bits int) IPOption {
+	return func(ir *ipResolver) {
+		ir.ipv6Bits = bits
+	}
+}
+
+// WithIPv4Prefix sets the prefix length IPv4 clients are aggregated to, 32 by
+// default
+func WithIPv4Prefix(bits int) IPOption {
+	return func(ir *ipResolver) {
+		ir.ipv4Bits = bits
+	}
+}
+
+type ipResolver struct {
+	trusted  []netip.Prefix
+	header   string
+	ipv4Bits int
+	ipv6Bits int
+}
+
+// ClientIP keys requests by client IP. If the connected peer is a trusted
+// proxy, the client is taken from the forwarding header set with
+// WithForwardedHeader: the addresses it lists are walked from the nearest hop
+// back and the first one that is not a trusted proxy is the client. Headers
+// from untrusted peers are ignored, so they cannot be spoofed. Addresses are
+// aggregated to prefixes, by default /64 for IPv6, and written as
+// "2001:db8::/64".
+func ClientIP(opts ...IPOption) KeyFunc {
+	ir := &ipResolver{header: "X-Forwarded-For", ipv4Bits: 32, ipv6Bits: 64}
+	for _, opt := range opts {
+		opt(ir)
+	}
+	return ir.key
+}
+
+func (ir *ipResolver) key(r *http.Request) string {
+	addr, ok := ir.resolve(r)
+	if !ok {
+		return ""
+	}
+	bits := ir.ipv4Bits
+	if addr.Is6() {
+		bits = ir.ipv6Bits
+	}
+	if bits <= 0 || bits >= addr.BitLen() {
+		return addr.String()
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return addr.String()
+	}
+	return prefix.String()
+}
+
+// resolve returns the client address of r
+func (ir *ipResolver) resolve(r *http.Request) (netip.Addr, bool) {
+	client, ok := parseAddr(r.RemoteAddr)
+	if !ok || !ir.isTrusted(client) {
+		return client, ok
+	}
+
+	hops := forwardedFor(r.Header, ir.header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, ok := parseAddr(hops[i])
+		if !ok {
+			// Everything before an unreadable hop is unreliable; stop at the last good one
+			break
+		}
+		client = addr
+		if !ir.isTrusted(addr) {
+			break
+		}
+	}
+	return client, true
+}
+
+func (ir *ipResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range ir.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwardedFor returns the client addresses listed by the header name, from
+// the original client to the nearest proxy
+func forwardedFor(h http.Header, name string) []string {
+	values := h.Values(name)
+	if len(values) == 0 {
+		return nil
+	}
+	elements := strings.Split(strings.Join(values, ","), ",")
+	if name != "Forwarded" {
+		return elements
+	}
+	var hops []string
+	for _, element := range elements {
+		for _, pair := range strings.Split(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(key, "for") {
+				hops = append(hops, strings.Trim(value, `"`))
+			}
+		}
+	}
+	return hops
+}
+
+// parseAddr parses an IP address with or without a port, such as
+// "192.0.2.1", "192.0.2.1:443", "2001:db8::1" or "[2001:db8::1]:443"
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), true
+	}
+	addr, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// Header keys requests by the value of a request header, such as an API key
+func Header(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// BearerToken keys requests by the token of an "Authorization: Bearer" header
+func BearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// QueryParam keys requests by the value of a query parameter
+func QueryParam(name string) KeyFunc {
+	return func(r *http.Request) string {
+		return r.URL.Query().Get(name)
+	}
+}
+
+// Named prefixes the keys of fn with name, so that keys from different
+// sources combined with FirstOf cannot collide
+func Named(name string, fn KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		if key := fn(r); key != "" {
+			return name + ":" + key
+		}
+		return ""
+	}
+}
+
+// FirstOf keys requests by the first of the functions that finds a key, such
+// as an API key if there is one and the client IP otherwise
+func FirstOf(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, fn := range fns {
+			if key := fn(r); key != "" {
+				return key
+			}
+		}
+		return ""
+	}
+}
+
+// All keys requests by the keys of all the functions together, such as the
+// tenant and the client IP. It finds no key if any of them finds none.
+func All(fns ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		keys := make([]string, len(fns))
+		for i, fn := range fns {
+			if keys[i] = fn(r); keys[i] == "" {
+				return ""
+			}
+		}
+		return strings.Join(keys, "\x00")
+	}
+}
@@ -0,0 +1,210 @@
+package httplimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/popeskul/ratelimiter/httplimit"
+)
+
+func TestClientIP(t *testing.T) {
+	trusted := httplimit.WithTrustedProxies(
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		header     http.Header
+		opts       []httplimit.IPOption
+		want       string
+	}{
+		{
+			name:       "Remote Addr",
+			remoteAddr: "203.0.113.7:5555",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Untrusted Peer Headers Ignored",
+			remoteAddr: "203.0.113.7:5555",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			opts:       []httplimit.IPOption{trusted},
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "No Trusted Proxies",
+			remoteAddr: "10.0.0.1:5555",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "X-Forwarded-For",
+			remoteAddr: "10.0.0.1:5555",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, 10.1.1.1"}},
+			opts:       []httplimit.IPOption{trusted},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed X-Forwarded-For",
+			remoteAddr: "10.0.0.1:5555",
+			header:     http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1", "10.1.1.1"}},
+			opts:       []httplimit.IPOption{trusted},
+			want:       "198.51.100.1",
+		},
+		{
+			name:       "Spoofed Forwarded",
+			remoteAddr: "10.0.0.1:5555",
+			header: http.Header{
+				"Forwarded":       {"for=1.1.1.1"},
+				"X-Forwarded-For": {"203.0.113.9"},
+			},
+			opts: []httplimit.IPOption{trusted},
+			want: "203.0.113.9",
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.0.0.1:5555",
+			header: http.Header{
+				"Forwarded":       {`for=192.0.2.60;proto=http;by=10.0.0.1, For="[2001:db8:cafe::17]:4711"`},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			opts: []httplimit.IPOption{trusted, httplimit.WithForwardedHeader("forwarded")},
+			want: "2001:db8:cafe::/64",
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "10.0.0.1:5555",
+			header: http.Header{
+				"X-Real-Ip":       {"198.51.100.1"},
+				"X-Forwarded-For": {"1.1.1.1"},
+			},
+			opts: []httplimit.IPOption{trusted, httplimit.WithForwardedHeader("X-Real-IP")},
+			want: "198.51.100.1",
+		},
+		{
+			name:       "No Fallback",
+			remoteAddr: "10.0.0.1:5555",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1"}},
+			opts:       []httplimit.IPOption{trusted, httplimit.WithForwardedHeader("X-Real-IP")},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "All Hops Trusted",
+			remoteAddr: "10.0.0.1:5555",
+			header:     http.Header{"X-Forwarded-For": {"10.2.2.2, 10.1.1.1"}},
+			opts:       []httplimit.IPOption{trusted},
+			want:       "10.2.2.2",
+		},
+		{
+			name:       "Unreadable Hop",
+			remoteAddr: "10.0.0.1:5555",
+			header:     http.Header{"X-Forwarded-For": {"198.51.100.1, unknown, 10.1.1.1"}},
+			opts:       []httplimit.IPOption{trusted},
+			want:       "10.1.1.1",
+		},
+		{
+			name:       "IPv6 Aggregation",
+			remoteAddr: "[2001:db8:1:2:3:4:5:6]:443",
+			want:       "2001:db8:1:2::/64",
+		},
+		{
+			name:       "IPv6 Full Address",
+			remoteAddr: "[2001:db8:1:2:3:4:5:6]:443",
+			opts:       []httplimit.IPOption{httplimit.WithIPv6Prefix(128)},
+			want:       "2001:db8:1:2:3:4:5:6",
+		},
+		{
+			name:       "IPv4 Aggregation",
+			remoteAddr: "203.0.113.7:5555",
+			opts:       []httplimit.IPOption{httplimit.WithIPv4Prefix(24)},
+			want:       "203.0.113.0/24",
+		},
+		{
+			name:       "IPv4 Mapped",
+			remoteAddr: "[::ffff:203.0.113.7]:5555",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "Unparseable Remote Addr",
+			remoteAddr: "pipe",
+			want:       "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, values := range tt.header {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			if got := httplimit.ClientIP(tt.opts...)(req); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestKeyFuncs(t *testing.T) {
+	newRequest := func(target string, header map[string]string) *http.Request {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.RemoteAddr = "203.0.113.7:5555"
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		return req
+	}
+
+	t.Run("Header", func(t *testing.T) {
+		req := newRequest("/", map[string]string{"X-API-Key": "k1"})
+		if got := httplimit.Header("X-API-Key")(req); got != "k1" {
+			t.Errorf("Expected k1, got %q", got)
+		}
+	})
+
+	t.Run("Bearer Token", func(t *testing.T) {
+		if got := httplimit.BearerToken(newRequest("/", map[string]string{"Authorization": "bearer abc"})); got != "abc" {
+			t.Errorf("Expected abc, got %q", got)
+		}
+		if got := httplimit.BearerToken(newRequest("/", map[string]string{"Authorization": "Basic abc"})); got != "" {
+			t.Errorf("Expected no key for basic auth, got %q", got)
+		}
+	})
+
+	t.Run("Query Param", func(t *testing.T) {
+		if got := httplimit.QueryParam("key")(newRequest("/?key=k2", nil)); got != "k2" {
+			t.Errorf("Expected k2, got %q", got)
+		}
+	})
+
+	t.Run("First Of", func(t *testing.T) {
+		key := httplimit.FirstOf(
+			httplimit.Named("key", httplimit.Header("X-API-Key")),
+			httplimit.Named("ip", httplimit.ClientIP()),
+		)
+		if got := key(newRequest("/", map[string]string{"X-API-Key": "k1"})); got != "key:k1" {
+			t.Errorf("Expected key:k1, got %q", got)
+		}
+		if got := key(newRequest("/", nil)); got != "ip:203.0.113.7" {
+			t.Errorf("Expected the client IP without an API key, got %q", got)
+		}
+		if got := httplimit.FirstOf(httplimit.Header("X-Missing"))(newRequest("/", nil)); got != "" {
+			t.Errorf("Expected no key, got %q", got)
+		}
+	})
+
+	t.Run("All", func(t *testing.T) {
+		key := httplimit.All(httplimit.Header("X-Tenant"), httplimit.ClientIP())
+		if got := key(newRequest("/", map[string]string{"X-Tenant": "acme"})); got != "acme\x00203.0.113.7" {
+			t.Errorf("Expected the tenant and the client IP, got %q", got)
+		}
+		if got := key(newRequest("/", nil)); got != "" {
+			t.Errorf("Expected no key when a part is missing, got %q", got)
+		}
+	})
+}
@@ -0,0 +1,238 @@
+// Package httplimit rate limits net/http handlers with the limiters of
+// ratelimiter. Requests are keyed, limited per key and rejected with 429 Too
+// Many Requests, and every response carries the Retry-After and IETF
+// RateLimit-* headers computed from the limiter state.
+package httplimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+// KeyFunc returns the key a request is limited by, such as the client IP or
+// an API key. An empty key means the function could not find one; WithEmptyKey
+// says what happens to such requests.
+type KeyFunc func(r *http.Request) string
+
+// RejectFunc writes the response for a request that was denied. The rate
+// limit headers are already set when it is called.
+type RejectFunc func(w http.ResponseWriter, r *http.Request, d ratelimiter.Decision)
+
+// EmptyKey says what happens to a request whose KeyFunc finds no key
+type EmptyKey int
+
+const (
+	// FallBackToRemoteAddr limits the request by RemoteAddr instead, so that
+	// clients without a key don't all share one limit. These limits are kept
+	// apart from those of keyed requests, so no key can use up or share the
+	// limit of an address.
+	FallBackToRemoteAddr EmptyKey = iota
+	// PassEmptyKey lets the request through without limiting it
+	PassEmptyKey
+	// RejectEmptyKey rejects the request with the reject handler
+	RejectEmptyKey
+)
+
+// Option configures a Middleware
+type Option func(*Middleware)
+
+// WithKeyFunc sets how requests are keyed. The default is RemoteAddr, the
+// address of the directly connected peer.
+func WithKeyFunc(keyFunc KeyFunc) Option {
+	return func(m *Middleware) {
+		m.keyFunc = keyFunc
+	}
+}
+
+// WithRejectHandler sets the function that writes the response for denied
+// requests. The default is DefaultReject.
+func WithRejectHandler(reject RejectFunc) Option {
+	return func(m *Middleware) {
+		m.reject = reject
+	}
+}
+
+// WithEmptyKey sets what happens to requests the KeyFunc finds no key for.
+// The default is FallBackToRemoteAddr.
+func WithEmptyKey(emptyKey EmptyKey) Option {
+	return func(m *Middleware) {
+		m.emptyKey = emptyKey
+	}
+}
+
+// Middleware limits the requests passed to a handler with a limiter per key
+type Middleware struct {
+	limit    *limit
+	keyFunc  KeyFunc
+	reject   RejectFunc
+	emptyKey EmptyKey
+}
+
+// New creates a Middleware whose per-key limiters are built from config as
+// ratelimiter.New would build them
+func New(config *ratelimiter.Config, opts ...Option) (*Middleware, error) {
+	l, err := newLimit(config)
+	if err != nil {
+		return nil, err
+	}
+	m := &Middleware{limit: l}
+	for _, opt := range opts {
+		opt(m)
+	}
+	m.setDefaults()
+	return m, nil
+}
+
+func (m *Middleware) setDefaults() {
+	if m.keyFunc == nil {
+		m.keyFunc = RemoteAddr
+	}
+	if m.reject == nil {
+		m.reject = DefaultReject
+	}
+}
+
+// Handler wraps next so that it only sees the requests the limiter admits
+func (m *Middleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.serve(w, r, next, m.limit)
+	})
+}
+
+// Close closes the limiters of every key
+func (m *Middleware) Close() error {
+	return m.limit.close()
+}
+
+// serve checks r against l and passes it to next or rejects it
+func (m *Middleware) serve(w http.ResponseWriter, r *http.Request, next http.Handler, l *limit) {
+	key := m.keyFunc(r)
+	if key == "" {
+		switch m.emptyKey {
+		case PassEmptyKey:
+			next.ServeHTTP(w, r)
+			return
+		case RejectEmptyKey:
+			m.reject(w, r, ratelimiter.Decision{RetryAfter: ratelimiter.InfDuration})
+			return
+		}
+	}
+
+	d := l.decide(key, r)
+	l.writeHeaders(w.Header(), d)
+	if !d.Allowed {
+		m.reject(w, r, d)
+		return
+	}
+	next.ServeHTTP(w, r)
+}
+
+// DefaultReject responds with 429 Too Many Requests
+func DefaultReject(w http.ResponseWriter, r *http.Request, d ratelimiter.Decision) {
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
+
+// RemoteAddr keys requests by the IP address of the directly connected peer
+func RemoteAddr(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limit is a keyed limiter together with the policy it enforces
+type limit struct {
+	keyed  *ratelimiter.KeyedLimiter
+	byAddr *ratelimiter.KeyedLimiter // requests without a key, kept apart so no key can collide with their address
+	policy string
+	clock  ratelimiter.Clock
+}
+
+func newLimit(config *ratelimiter.Config) (*limit, error) {
+	keyed, err := ratelimiter.NewKeyedLimiter(ratelimiter.WithConfig(config))
+	if err != nil {
+		return nil, err
+	}
+	// The config was accepted above, so it builds a second time
+	byAddr, _ := ratelimiter.NewKeyedLimiter(ratelimiter.WithConfig(config))
+	clock := config.Clock
+	if clock == nil {
+		clock = ratelimiter.SystemClock()
+	}
+	return &limit{keyed: keyed, byAddr: byAddr, policy: policy(config), clock: clock}, nil
+}
+
+// close closes the limiters of every key
+func (l *limit) close() error {
+	return errors.Join(l.keyed.Close(), l.byAddr.Close())
+}
+
+// decide admits a request for key, or for the address of r if key is empty,
+// and reports the decision
+func (l *limit) decide(key string, r *http.Request) ratelimiter.Decision {
+	keyed := l.keyed
+	if key == "" {
+		keyed, key = l.byAddr, RemoteAddr(r)
+	}
+	limiter := keyed.Limiter(key)
+	if admitter, ok := limiter.(ratelimiter.Admitter); ok {
+		return admitter.AllowDecision(1)
+	}
+	return ratelimiter.Decision{Allowed: limiter.Allow(), RetryAfter: ratelimiter.InfDuration}
+}
+
+// writeHeaders sets the rate limit headers describing d
+func (l *limit) writeHeaders(h http.Header, d ratelimiter.Decision) {
+	if d.Limit > 0 {
+		h.Set("RateLimit-Limit", strconv.FormatInt(d.Limit, 10))
+		h.Set("RateLimit-Remaining", strconv.FormatInt(d.Remaining, 10))
+		if l.policy != "" {
+			h.Set("RateLimit-Policy", l.policy)
+		}
+	}
+	if !d.ResetAt.IsZero() {
+		h.Set("RateLimit-Reset", seconds(d.ResetAt.Sub(l.clock.Now())))
+	}
+	if !d.Allowed && d.RetryAfter != ratelimiter.InfDuration {
+		h.Set("Retry-After", seconds(d.RetryAfter))
+	}
+}
+
+// policy describes the limit of config as a RateLimit-Policy quota and window.
+// The quota is the one RateLimit-Limit reports: a full token bucket refilled
+// over the time it takes, or a GCRA burst over the intervals it spans.
+func policy(config *ratelimiter.Config) string {
+	switch config.Algorithm {
+	case ratelimiter.TokenBucketAlgorithm:
+		refill := time.Duration(float64(config.Capacity) / float64(config.Rate) * float64(time.Second))
+		return fmt.Sprintf("%d;w=%s", config.Capacity, seconds(refill))
+	case ratelimiter.GCRAAlgorithm:
+		burst := max(config.Burst, 1)
+		return fmt.Sprintf("%d;w=%s", burst, seconds(config.Window*time.Duration(burst)/time.Duration(config.Rate)))
+	case ratelimiter.LeakyBucketAlgorithm:
+		return fmt.Sprintf("%d;w=1", config.Rate)
+	case ratelimiter.NestedWindowAlgorithm:
+		inner := config.InnerWindow
+		if inner <= 0 {
+			inner = config.Window / 10
+		}
+		return fmt.Sprintf("%d;w=%s, %d;w=%s", config.Rate, seconds(config.Window), config.Burst, seconds(inner))
+	case ratelimiter.FixedWindowAlgorithm, ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm:
+		return fmt.Sprintf("%d;w=%s", config.Rate, seconds(config.Window))
+	}
+	return ""
+}
+
+// seconds formats d as whole seconds, rounded up
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(max(d, 0).Seconds())), 10)
+}
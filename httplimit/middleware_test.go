@@ -0,0 +1,215 @@
+package httplimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+	"github.com/popeskul/ratelimiter/httplimit"
+)
+
+func TestMiddleware(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newConfig := func(s string) (*ratelimiter.Config, *ratelimiter.FakeClock) {
+		t.Helper()
+		config, err := ratelimiter.ParseConfig(s)
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+		clock := ratelimiter.NewFakeClock(start)
+		config.Clock = clock
+		return config, clock
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	newMiddleware := func(t *testing.T, config *ratelimiter.Config, opts ...httplimit.Option) *httplimit.Middleware {
+		t.Helper()
+		m, err := httplimit.New(config, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create middleware: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := m.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		})
+		return m
+	}
+
+	serve := func(h http.Handler, remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("Headers", func(t *testing.T) {
+		config, clock := newConfig("2/m algo=fixed_window")
+		h := newMiddleware(t, config).Handler(ok)
+
+		serve(h, "10.0.0.1:1234")
+		clock.Advance(20 * time.Second)
+
+		rec := serve(h, "10.0.0.1:1234")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d", rec.Code)
+		}
+		want := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "0",
+			"RateLimit-Reset":     "40",
+			"RateLimit-Policy":    "2;w=60",
+		}
+		for name, value := range want {
+			if got := rec.Header().Get(name); got != value {
+				t.Errorf("Expected %s: %s, got %q", name, value, got)
+			}
+		}
+		if got := rec.Header().Get("Retry-After"); got != "" {
+			t.Errorf("Expected no Retry-After on an admitted request, got %q", got)
+		}
+
+		rec = serve(h, "10.0.0.1:1234")
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expected 429, got %d", rec.Code)
+		}
+		if got := rec.Header().Get("Retry-After"); got != "40" {
+			t.Errorf("Expected Retry-After: 40, got %q", got)
+		}
+
+		if rec := serve(h, "10.0.0.2:1234"); rec.Code != http.StatusOK {
+			t.Errorf("Another client should have its own limit, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Policies", func(t *testing.T) {
+		tests := map[string]string{
+			"5/s algo=token_bucket":                             "100;w=20",
+			"5/s capacity=10 algo=token_bucket":                 "10;w=2",
+			"3/s capacity=10 algo=token_bucket":                 "10;w=4",
+			"5/s algo=leaky_bucket":                             "5;w=1",
+			"100/m burst=10 algo=nested_window":                 "100;w=60, 10;w=6",
+			"100/h algo=sliding_window_counter":                 "100;w=3600",
+			"3/1500ms algo=gcra":                                "1;w=1",
+			"3/1500ms burst=3 algo=gcra":                        "3;w=2",
+			"100/m burst=10 inner_window=5s algo=nested_window": "100;w=60, 10;w=5",
+		}
+		for s, want := range tests {
+			config, _ := newConfig(s)
+			rec := serve(newMiddleware(t, config).Handler(ok), "10.0.0.1:1234")
+			if got := rec.Header().Get("RateLimit-Policy"); got != want {
+				t.Errorf("%s: expected policy %q, got %q", s, want, got)
+			}
+			// A single quota is the limit RateLimit-Limit reports
+			if limit := rec.Header().Get("RateLimit-Limit"); !strings.Contains(want, ",") && !strings.HasPrefix(want, limit+";") {
+				t.Errorf("%s: expected RateLimit-Limit to match the policy %q, got %q", s, want, limit)
+			}
+		}
+	})
+
+	t.Run("Key Func", func(t *testing.T) {
+		config, _ := newConfig("1/m algo=fixed_window")
+		h := newMiddleware(t, config, httplimit.WithKeyFunc(func(r *http.Request) string {
+			return r.Header.Get("X-Tenant")
+		})).Handler(ok)
+
+		for i, tt := range []struct {
+			addr, tenant string
+			code         int
+		}{
+			{"10.0.0.1:1", "acme", http.StatusOK},
+			{"10.0.0.2:1", "acme", http.StatusTooManyRequests},
+			{"10.0.0.1:1", "globex", http.StatusOK},
+		} {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.addr
+			req.Header.Set("X-Tenant", tt.tenant)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("Request %d: expected %d, got %d", i, tt.code, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Empty Key", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			opts  []httplimit.Option
+			codes []int
+		}{
+			{"Fall Back To Remote Addr", nil, []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests}},
+			{"Pass", []httplimit.Option{httplimit.WithEmptyKey(httplimit.PassEmptyKey)}, []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+			{"Reject", []httplimit.Option{httplimit.WithEmptyKey(httplimit.RejectEmptyKey)}, []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusTooManyRequests}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				config, _ := newConfig("1/m algo=fixed_window")
+				opts := append([]httplimit.Option{httplimit.WithKeyFunc(httplimit.Header("X-API-Key"))}, tt.opts...)
+				h := newMiddleware(t, config, opts...).Handler(ok)
+
+				// Two anonymous clients, then the first one again
+				for i, addr := range []string{"10.0.0.1:1", "10.0.0.2:1", "10.0.0.1:1"} {
+					if rec := serve(h, addr); rec.Code != tt.codes[i] {
+						t.Errorf("Request %d: expected %d, got %d", i, tt.codes[i], rec.Code)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("Key Colliding With Remote Addr", func(t *testing.T) {
+		config, _ := newConfig("1/m algo=fixed_window")
+		h := newMiddleware(t, config, httplimit.WithKeyFunc(httplimit.Header("X-API-Key"))).Handler(ok)
+
+		// A client naming its victim's address as its key must not use up the
+		// limit the victim falls back to without a key
+		attack := httptest.NewRequest(http.MethodGet, "/", nil)
+		attack.RemoteAddr = "10.0.0.66:1"
+		attack.Header.Set("X-API-Key", "10.0.0.1")
+		for i := 0; i < 3; i++ {
+			h.ServeHTTP(httptest.NewRecorder(), attack)
+		}
+
+		if rec := serve(h, "10.0.0.1:1"); rec.Code != http.StatusOK {
+			t.Errorf("Expected the anonymous client to keep its own limit, got %d", rec.Code)
+		}
+	})
+
+	t.Run("Reject Handler", func(t *testing.T) {
+		config, _ := newConfig("1/m algo=fixed_window")
+		var denied ratelimiter.Decision
+		h := newMiddleware(t, config, httplimit.WithRejectHandler(
+			func(w http.ResponseWriter, r *http.Request, d ratelimiter.Decision) {
+				denied = d
+				w.WriteHeader(http.StatusServiceUnavailable)
+			})).Handler(ok)
+
+		serve(h, "10.0.0.1:1")
+		rec := serve(h, "10.0.0.1:1")
+		if rec.Code != http.StatusServiceUnavailable {
+			t.Errorf("Expected the custom response, got %d", rec.Code)
+		}
+		if denied.Allowed || denied.RetryAfter != time.Minute {
+			t.Errorf("Expected the denial to be passed on, got %+v", denied)
+		}
+		if rec.Header().Get("Retry-After") != "60" {
+			t.Errorf("Expected headers to be set before the reject handler, got %v", rec.Header())
+		}
+	})
+
+	t.Run("Invalid Config", func(t *testing.T) {
+		config, _ := newConfig("0/m algo=fixed_window")
+		if _, err := httplimit.New(config); err == nil {
+			t.Error("Expected an error for an invalid config")
+		}
+	})
+}
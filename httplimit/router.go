@@ -0,0 +1,88 @@
+package httplimit
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+// Router limits requests per route. Limits are registered for ServeMux
+// patterns such as "POST /v1/orders/{id}" and a request is limited by the
+// pattern it matched rather than its path, so /v1/orders/1 and /v1/orders/2
+// share the budget of their route. Each route keeps its own limiter per key.
+type Router struct {
+	mw     Middleware
+	mu     sync.RWMutex
+	routes map[string]*limit
+}
+
+// NewRouter creates a Router without any limits. The options are those of
+// New and apply to every route.
+func NewRouter(opts ...Option) *Router {
+	rt := &Router{routes: make(map[string]*limit)}
+	for _, opt := range opts {
+		opt(&rt.mw)
+	}
+	rt.mw.setDefaults()
+	return rt
+}
+
+// Limit limits the requests matching pattern with limiters built from config
+// as ratelimiter.New would build them. The pattern must be written exactly as
+// it is registered with the ServeMux.
+func (rt *Router) Limit(pattern string, config *ratelimiter.Config) error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	if _, ok := rt.routes[pattern]; ok {
+		return fmt.Errorf("route %q is already limited", pattern)
+	}
+	l, err := newLimit(config)
+	if err != nil {
+		return fmt.Errorf("route %q: %w", pattern, err)
+	}
+	rt.routes[pattern] = l
+	return nil
+}
+
+// Handler wraps next so that it only sees the requests the limit of their
+// route admits. Requests of routes without a limit pass through.
+//
+// The route is taken from http.Request.Pattern, which the ServeMux sets
+// before calling the handler of a route, so Handler can wrap the handlers
+// registered with a mux. It can also wrap a *http.ServeMux itself, in which
+// case the pattern is looked up from the mux.
+func (rt *Router) Handler(next http.Handler) http.Handler {
+	mux, _ := next.(*http.ServeMux)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pattern := r.Pattern
+		if pattern == "" && mux != nil {
+			_, pattern = mux.Handler(r)
+		}
+
+		rt.mu.RLock()
+		l := rt.routes[pattern]
+		rt.mu.RUnlock()
+
+		if l == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		rt.mw.serve(w, r, next, l)
+	})
+}
+
+// Close closes the limiters of every route and returns their errors joined.
+func (rt *Router) Close() error {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	var errs []error
+	for _, l := range rt.routes {
+		errs = append(errs, l.close())
+	}
+	return errors.Join(errs...)
+}
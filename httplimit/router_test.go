@@ -0,0 +1,141 @@
+package httplimit_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+	"github.com/popeskul/ratelimiter/httplimit"
+)
+
+func TestRouter(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	newConfig := func(s string) *ratelimiter.Config {
+		t.Helper()
+		config, err := ratelimiter.ParseConfig(s)
+		if err != nil {
+			t.Fatalf("Failed to parse config: %v", err)
+		}
+		config.Clock = ratelimiter.NewFakeClock(start)
+		return config
+	}
+
+	newRouter := func(t *testing.T, opts ...httplimit.Option) *httplimit.Router {
+		t.Helper()
+		rt := httplimit.NewRouter(opts...)
+		t.Cleanup(func() {
+			if err := rt.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		})
+		if err := rt.Limit("POST /v1/orders/{id}", newConfig("2/m algo=fixed_window")); err != nil {
+			t.Fatalf("Failed to add limit: %v", err)
+		}
+		if err := rt.Limit("GET /v1/orders/{id}", newConfig("5/m algo=fixed_window")); err != nil {
+			t.Fatalf("Failed to add limit: %v", err)
+		}
+		return rt
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	serve := func(h http.Handler, method, target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	check := func(t *testing.T, h http.Handler) {
+		t.Helper()
+		for i, tt := range []struct {
+			method, target string
+			code           int
+		}{
+			{http.MethodPost, "/v1/orders/1", http.StatusOK},
+			{http.MethodPost, "/v1/orders/2", http.StatusOK},
+			{http.MethodPost, "/v1/orders/3", http.StatusTooManyRequests},
+			{http.MethodGet, "/v1/orders/3", http.StatusOK},
+			{http.MethodGet, "/health", http.StatusOK},
+		} {
+			if rec := serve(h, tt.method, tt.target); rec.Code != tt.code {
+				t.Errorf("Request %d (%s %s): expected %d, got %d", i, tt.method, tt.target, tt.code, rec.Code)
+			}
+		}
+	}
+
+	t.Run("Wrapped Handlers", func(t *testing.T) {
+		rt := newRouter(t)
+		mux := http.NewServeMux()
+		mux.Handle("POST /v1/orders/{id}", rt.Handler(ok))
+		mux.Handle("GET /v1/orders/{id}", rt.Handler(ok))
+		mux.Handle("GET /health", rt.Handler(ok))
+		check(t, mux)
+	})
+
+	t.Run("Wrapped Mux", func(t *testing.T) {
+		rt := newRouter(t)
+		mux := http.NewServeMux()
+		mux.Handle("POST /v1/orders/{id}", ok)
+		mux.Handle("GET /v1/orders/{id}", ok)
+		mux.Handle("GET /health", ok)
+		check(t, rt.Handler(mux))
+	})
+
+	t.Run("Headers", func(t *testing.T) {
+		rt := newRouter(t)
+		mux := http.NewServeMux()
+		mux.Handle("GET /v1/orders/{id}", ok)
+		mux.Handle("GET /health", ok)
+		h := rt.Handler(mux)
+
+		if got := serve(h, http.MethodGet, "/v1/orders/1").Header().Get("RateLimit-Policy"); got != "5;w=60" {
+			t.Errorf("Expected the policy of the route, got %q", got)
+		}
+		if got := serve(h, http.MethodGet, "/health").Header().Get("RateLimit-Limit"); got != "" {
+			t.Errorf("Expected no headers for an unlimited route, got %q", got)
+		}
+	})
+
+	t.Run("Key Func", func(t *testing.T) {
+		rt := newRouter(t, httplimit.WithKeyFunc(httplimit.Header("X-Tenant")))
+		mux := http.NewServeMux()
+		mux.Handle("POST /v1/orders/{id}", ok)
+		h := rt.Handler(mux)
+
+		for i, tt := range []struct {
+			tenant string
+			code   int
+		}{
+			{"acme", http.StatusOK},
+			{"acme", http.StatusOK},
+			{"acme", http.StatusTooManyRequests},
+			{"globex", http.StatusOK},
+		} {
+			req := httptest.NewRequest(http.MethodPost, "/v1/orders/1", nil)
+			req.Header.Set("X-Tenant", tt.tenant)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.code {
+				t.Errorf("Request %d: expected %d, got %d", i, tt.code, rec.Code)
+			}
+		}
+	})
+
+	t.Run("Invalid Limits", func(t *testing.T) {
+		rt := newRouter(t)
+		if err := rt.Limit("GET /v1/orders/{id}", newConfig("1/s")); err == nil {
+			t.Error("Expected an error for a route that is already limited")
+		}
+		if err := rt.Limit("GET /v2/orders/{id}", newConfig("0/m algo=fixed_window")); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+	})
+}
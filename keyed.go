@@ -0,0 +1,265 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"hash/maphash"
+	"sync"
+	"time"
+)
+
+// Keyed maintains an independent Limiter per key of any comparable type
+// (user ID, netip.Addr, tenant struct, ...).
+// Limiters are created lazily from the shared Config on first use, evicted after
+// KeyTTL of inactivity and capped at MaxKeys in least-recently-used order.
+// A limiter is closed when it is evicted, removed or reset, so callers still
+// blocked in its Wait get ErrLimiterClosed instead of waiting on a stale limiter.
+// Keys are spread over Shards independently locked shards, so the key limit is
+// enforced per shard and eviction order is approximate across shards.
+type Keyed[K comparable] struct {
+	config *Config
+	ttl    time.Duration
+	seed   maphash.Seed
+	clock  Clock
+	closed closer
+	shards []*keyedShard[K]
+}
+
+// KeyedLimiter is a Keyed limiter for string keys
+type KeyedLimiter = Keyed[string]
+
+type keyedShard[K comparable] struct {
+	mu      sync.Mutex
+	maxKeys int
+	entries map[K]*list.Element
+	lru     *list.List // front is the most recently used entry
+}
+
+type keyedEntry[K comparable] struct {
+	key      K
+	limiter  Limiter
+	lastSeen int64
+}
+
+// NewKeyedLimiter creates a KeyedLimiter for string keys
+func NewKeyedLimiter(opts ...Option) (*KeyedLimiter, error) {
+	return NewKeyed[string](opts...)
+}
+
+// NewKeyed creates a Keyed limiter whose per-key limiters are built as New would build them
+func NewKeyed[K comparable](opts ...Option) (*Keyed[K], error) {
+	config := DefaultConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	// Build one limiter up front so that an invalid config fails here rather than on the hot path
+	if _, err := newLimiter(config); err != nil {
+		return nil, err
+	}
+
+	shardCount := config.Shards
+	if shardCount <= 0 {
+		shardCount = 1
+	}
+	if config.MaxKeys > 0 && config.MaxKeys < shardCount {
+		shardCount = config.MaxKeys
+	}
+
+	maxKeys := 0
+	if config.MaxKeys > 0 {
+		maxKeys = (config.MaxKeys + shardCount - 1) / shardCount
+	}
+
+	kl := &Keyed[K]{
+		config: config,
+		ttl:    config.KeyTTL,
+		seed:   maphash.MakeSeed(),
+		clock:  config.clockOrDefault(),
+		shards: make([]*keyedShard[K], shardCount),
+	}
+	for i := range kl.shards {
+		kl.shards[i] = &keyedShard[K]{
+			maxKeys: maxKeys,
+			entries: make(map[K]*list.Element),
+			lru:     list.New(),
+		}
+	}
+	return kl, nil
+}
+
+// AllowKey checks if a request for key is allowed
+func (kl *Keyed[K]) AllowKey(key K) bool {
+	return kl.Limiter(key).Allow()
+}
+
+// AllowNKey checks if N requests for key are allowed
+func (kl *Keyed[K]) AllowNKey(key K, n int) bool {
+	return kl.Limiter(key).AllowN(n)
+}
+
+// WaitKey blocks until a request for key is allowed
+func (kl *Keyed[K]) WaitKey(ctx context.Context, key K) error {
+	return kl.Limiter(key).Wait(ctx)
+}
+
+// WaitNKey blocks until N requests for key are allowed
+func (kl *Keyed[K]) WaitNKey(ctx context.Context, key K, n int) error {
+	return kl.Limiter(key).WaitN(ctx, n)
+}
+
+// Limiter returns the limiter for key, creating it if needed
+func (kl *Keyed[K]) Limiter(key K) Limiter {
+	return kl.shard(key).get(key, kl.clock.Now().UnixNano(), kl)
+}
+
+// Remove drops and closes the limiter for key, if any
+func (kl *Keyed[K]) Remove(key K) {
+	kl.shard(key).remove(key)
+}
+
+// Len returns the number of keys currently tracked, including idle keys not yet evicted
+func (kl *Keyed[K]) Len() int {
+	total := 0
+	for _, s := range kl.shards {
+		s.mu.Lock()
+		total += s.lru.Len()
+		s.mu.Unlock()
+	}
+	return total
+}
+
+// Prune evicts every key idle for longer than KeyTTL and returns how many were evicted.
+// Idle keys are also evicted lazily when new keys are added to their shard.
+func (kl *Keyed[K]) Prune() int {
+	now := kl.clock.Now().UnixNano()
+	evicted := 0
+	for _, s := range kl.shards {
+		s.mu.Lock()
+		evicted += s.evictExpired(now, kl.ttl)
+		s.mu.Unlock()
+	}
+	return evicted
+}
+
+// Close closes the limiters of all keys, waking their blocked waiters with
+// ErrLimiterClosed. Limiters handed out afterwards are already closed.
+func (kl *Keyed[K]) Close() error {
+	kl.closed.close()
+	var errs []error
+	for _, s := range kl.shards {
+		s.mu.Lock()
+		for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+			if err := closeLimiter(elem.Value.(*keyedEntry[K]).limiter); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		s.entries = make(map[K]*list.Element)
+		s.lru.Init()
+		s.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Reset drops and closes the limiters for all keys
+func (kl *Keyed[K]) Reset() {
+	for _, s := range kl.shards {
+		s.mu.Lock()
+		for elem := s.lru.Front(); elem != nil; elem = elem.Next() {
+			closeEntry(elem.Value.(*keyedEntry[K]))
+		}
+		s.entries = make(map[K]*list.Element)
+		s.lru.Init()
+		s.mu.Unlock()
+	}
+}
+
+func (kl *Keyed[K]) shard(key K) *keyedShard[K] {
+	if len(kl.shards) == 1 {
+		return kl.shards[0]
+	}
+	return kl.shards[hashKey(kl.seed, key)%uint64(len(kl.shards))]
+}
+
+func (kl *Keyed[K]) newEntryLimiter() Limiter {
+	config := *kl.config
+	// The config was validated in NewKeyed, so building from a copy cannot fail
+	limiter, _ := newLimiter(&config)
+	return limiter
+}
+
+func (s *keyedShard[K]) get(key K, now int64, kl *Keyed[K]) Limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if kl.closed.isClosed() {
+		limiter := kl.newEntryLimiter()
+		// The limiter was never handed out, so there is nothing to report
+		_ = closeLimiter(limiter)
+		return limiter
+	}
+
+	if elem, ok := s.entries[key]; ok {
+		entry := elem.Value.(*keyedEntry[K])
+		if kl.ttl > 0 && now-entry.lastSeen >= kl.ttl.Nanoseconds() {
+			// The key went idle; start over with a fresh limiter
+			closeEntry(entry)
+			entry.limiter = kl.newEntryLimiter()
+		}
+		entry.lastSeen = now
+		s.lru.MoveToFront(elem)
+		return entry.limiter
+	}
+
+	s.evictExpired(now, kl.ttl)
+	for s.maxKeys > 0 && s.lru.Len() >= s.maxKeys {
+		s.removeElement(s.lru.Back())
+	}
+
+	entry := &keyedEntry[K]{
+		key:      key,
+		limiter:  kl.newEntryLimiter(),
+		lastSeen: now,
+	}
+	s.entries[key] = s.lru.PushFront(entry)
+	return entry.limiter
+}
+
+func (s *keyedShard[K]) remove(key K) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.removeElement(elem)
+	}
+}
+
+// evictExpired removes idle entries from the back of the LRU list; the caller holds s.mu
+func (s *keyedShard[K]) evictExpired(now int64, ttl time.Duration) int {
+	if ttl <= 0 {
+		return 0
+	}
+	evicted := 0
+	for elem := s.lru.Back(); elem != nil; elem = s.lru.Back() {
+		if now-elem.Value.(*keyedEntry[K]).lastSeen < ttl.Nanoseconds() {
+			break
+		}
+		s.removeElement(elem)
+		evicted++
+	}
+	return evicted
+}
+
+func (s *keyedShard[K]) removeElement(elem *list.Element) {
+	entry := elem.Value.(*keyedEntry[K])
+	delete(s.entries, entry.key)
+	s.lru.Remove(elem)
+	closeEntry(entry)
+}
+
+// closeEntry closes the limiter of an entry that leaves the map. Eviction has
+// no caller to report a failed Close to, so the error is dropped.
+func closeEntry[K comparable](entry *keyedEntry[K]) {
+	_ = closeLimiter(entry.limiter)
+}
@@ -0,0 +1,72 @@
+package ratelimiter
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"math"
+	"reflect"
+)
+
+// hashKey hashes a key so that equal keys always get equal hashes. It stands
+// in for maphash.Comparable, which needs Go 1.24: string keys are hashed
+// directly and other keys by walking their value.
+func hashKey[K comparable](seed maphash.Seed, key K) uint64 {
+	if s, ok := any(key).(string); ok {
+		return maphash.String(seed, s)
+	}
+	var h maphash.Hash
+	h.SetSeed(seed)
+	writeKeyValue(&h, reflect.ValueOf(key))
+	return h.Sum64()
+}
+
+// writeKeyValue writes the parts of v that == compares. Unexported fields are
+// read through the kind accessors, which reflect allows for them.
+func writeKeyValue(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	writeUint := func(u uint64) {
+		binary.LittleEndian.PutUint64(buf[:], u)
+		_, _ = h.Write(buf[:])
+	}
+	writeFloat := func(f float64) {
+		if f == 0 {
+			f = 0 // -0 == +0, so both must hash alike
+		}
+		writeUint(math.Float64bits(f))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			writeUint(1)
+		} else {
+			writeUint(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		c := v.Complex()
+		writeFloat(real(c))
+		writeFloat(imag(c))
+	case reflect.String:
+		_, _ = h.WriteString(v.String())
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		writeUint(uint64(v.Pointer()))
+	case reflect.Interface:
+		if !v.IsNil() {
+			writeKeyValue(h, v.Elem())
+		}
+	case reflect.Array:
+		for i := range v.Len() {
+			writeKeyValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := range v.NumField() {
+			writeKeyValue(h, v.Field(i))
+		}
+	}
+}
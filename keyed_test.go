@@ -0,0 +1,283 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/popeskul/ratelimiter"
+	"math"
+	"net/netip"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiter(t *testing.T) {
+	t.Run("Independent Keys", func(t *testing.T) {
+		limiter, err := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(2),
+			ratelimiter.WithWindow(time.Second),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create keyed limiter: %v", err)
+		}
+
+		for i := 0; i < 2; i++ {
+			if !limiter.AllowKey("alice") {
+				t.Errorf("Request %d for alice should be allowed", i+1)
+			}
+		}
+		if limiter.AllowKey("alice") {
+			t.Error("Third request for alice should be denied")
+		}
+		if !limiter.AllowKey("bob") {
+			t.Error("First request for bob should be allowed")
+		}
+		if limiter.Len() != 2 {
+			t.Errorf("Expected 2 keys, got %d", limiter.Len())
+		}
+	})
+
+	t.Run("Unsupported Algorithm", func(t *testing.T) {
+		_, err := ratelimiter.NewKeyedLimiter(ratelimiter.WithAlgorithm("unknown"))
+		if err != ratelimiter.ErrUnsupportedAlgorithm {
+			t.Errorf("Expected ErrUnsupportedAlgorithm, got %v", err)
+		}
+	})
+
+	t.Run("MaxKeys LRU", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Minute),
+			ratelimiter.WithMaxKeys(2),
+			ratelimiter.WithShards(1),
+		)
+
+		limiter.AllowKey("a")
+		limiter.AllowKey("b")
+		limiter.AllowKey("a") // a becomes most recently used
+		limiter.AllowKey("c") // evicts b
+
+		if limiter.Len() != 2 {
+			t.Errorf("Expected 2 keys, got %d", limiter.Len())
+		}
+		if !limiter.AllowKey("b") {
+			t.Error("Evicted key b should start with a fresh limiter")
+		}
+		if limiter.AllowKey("c") {
+			t.Error("Key c should still be limited")
+		}
+	})
+
+	t.Run("Idle TTL", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Minute),
+			ratelimiter.WithKeyTTL(50*time.Millisecond),
+		)
+
+		limiter.AllowKey("a")
+		limiter.AllowKey("b")
+		if limiter.AllowKey("a") {
+			t.Error("Second request for a should be denied")
+		}
+
+		time.Sleep(60 * time.Millisecond)
+
+		if evicted := limiter.Prune(); evicted != 2 {
+			t.Errorf("Expected 2 evicted keys, got %d", evicted)
+		}
+		if limiter.Len() != 0 {
+			t.Errorf("Expected 0 keys after prune, got %d", limiter.Len())
+		}
+		if !limiter.AllowKey("a") {
+			t.Error("Request for a should be allowed after eviction")
+		}
+	})
+
+	t.Run("Dropped Limiters Closed", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(time.Now())
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Hour),
+			ratelimiter.WithMaxKeys(1),
+			ratelimiter.WithShards(1),
+			ratelimiter.WithKeyTTL(time.Minute),
+			ratelimiter.WithClock(clock),
+		)
+
+		for _, tt := range []struct {
+			name string
+			drop func(key string)
+		}{
+			{"Evicted", func(string) { limiter.AllowKey("other") }},
+			{"Expired", func(key string) {
+				clock.Advance(time.Minute)
+				limiter.AllowKey(key)
+			}},
+			{"Removed", func(key string) { limiter.Remove(key) }},
+			{"Reset", func(string) { limiter.Reset() }},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				old := limiter.Limiter("a")
+				old.Allow()
+
+				done := make(chan error, 1)
+				go func() { done <- old.Wait(context.Background()) }()
+				clock.BlockUntil(1)
+
+				tt.drop("a")
+				select {
+				case err := <-done:
+					if !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+						t.Errorf("Expected ErrLimiterClosed, got %v", err)
+					}
+				case <-time.After(time.Second):
+					t.Fatal("Dropping the limiter should wake its waiter")
+				}
+			})
+		}
+	})
+
+	t.Run("WaitKey", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("token_bucket"),
+			ratelimiter.WithRate(10),
+			ratelimiter.WithCapacity(1),
+		)
+
+		if err := limiter.WaitKey(context.Background(), "a"); err != nil {
+			t.Errorf("First wait should not error: %v", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := limiter.WaitKey(ctx, "a"); err == nil {
+			t.Error("Second wait should time out")
+		}
+		if err := limiter.WaitNKey(context.Background(), "b", 1); err != nil {
+			t.Errorf("Wait for another key should not error: %v", err)
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewKeyedLimiter(
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(10),
+			ratelimiter.WithWindow(time.Minute),
+		)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		allowed := 0
+		for i := 0; i < 500; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				if limiter.AllowKey(fmt.Sprintf("key-%d", i%10)) {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+			}(i)
+		}
+		wg.Wait()
+
+		if allowed != 100 {
+			t.Errorf("Expected 100 allowed requests, got %d", allowed)
+		}
+	})
+}
+
+func TestKeyed(t *testing.T) {
+	t.Run("Address Keys", func(t *testing.T) {
+		limiter, err := ratelimiter.NewKeyed[netip.Addr](
+			ratelimiter.WithAlgorithm("sliding_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create keyed limiter: %v", err)
+		}
+
+		a := netip.MustParseAddr("192.0.2.1")
+		b := netip.MustParseAddr("2001:db8::1")
+
+		if !limiter.AllowKey(a) {
+			t.Error("First request for a should be allowed")
+		}
+		if limiter.AllowKey(netip.MustParseAddr("192.0.2.1")) {
+			t.Error("Second request for an equal address should be denied")
+		}
+		if !limiter.AllowKey(b) {
+			t.Error("First request for b should be allowed")
+		}
+	})
+
+	t.Run("Struct Keys", func(t *testing.T) {
+		type tenantRoute struct {
+			tenant uint64
+			route  string
+		}
+
+		limiter, _ := ratelimiter.NewKeyed[tenantRoute](
+			ratelimiter.WithAlgorithm("nested_window"),
+			ratelimiter.WithRate(10),
+			ratelimiter.WithBurst(2),
+			ratelimiter.WithWindow(time.Second),
+		)
+
+		key := tenantRoute{tenant: 42, route: "/search"}
+		if !limiter.AllowNKey(key, 2) {
+			t.Error("AllowNKey(2) should be allowed")
+		}
+		if limiter.AllowKey(key) {
+			t.Error("Request beyond burst should be denied")
+		}
+		if !limiter.AllowKey(tenantRoute{tenant: 43, route: "/search"}) {
+			t.Error("Request for another tenant should be allowed")
+		}
+
+		limiter.Remove(key)
+		if !limiter.AllowKey(key) {
+			t.Error("Request should be allowed after removing the key")
+		}
+	})
+
+	t.Run("Equal Keys", func(t *testing.T) {
+		type point struct {
+			x, y float64
+			tag  any
+		}
+
+		limiter, _ := ratelimiter.NewKeyed[any](
+			ratelimiter.WithAlgorithm("fixed_window"),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Minute),
+			ratelimiter.WithShards(64),
+		)
+
+		negZero := math.Copysign(0, -1)
+		for i, pair := range [][2]any{
+			{0.0, negZero},
+			{point{x: 1, y: 0, tag: "a"}, point{x: 1, y: negZero, tag: "a"}},
+			{[2]int{1, 2}, [2]int{1, 2}},
+			{netip.MustParseAddr("192.0.2.1"), netip.MustParseAddr("192.0.2.1")},
+			{"key", "key"},
+		} {
+			if !limiter.AllowKey(pair[0]) {
+				t.Errorf("Pair %d: first request should be allowed", i)
+			}
+			if limiter.AllowKey(pair[1]) {
+				t.Errorf("Pair %d: an equal key %#v should share the limiter of %#v", i, pair[1], pair[0])
+			}
+		}
+		if limiter.Len() != 5 {
+			t.Errorf("Expected 5 keys, got %d", limiter.Len())
+		}
+	})
+}
@@ -0,0 +1,307 @@
+package ratelimiter
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// LeakyBucket releases requests at a steady Rate per second. Callers of Wait
+// and WaitN are queued, up to QueueSize of them, and each is scheduled into
+// its own slot so that downstream sees a constant drip instead of bursts.
+type LeakyBucket struct {
+	rate         int64
+	interval     int64 // time between two releases in nanoseconds
+	queueSize    int64
+	maxWaiters   int64
+	next         int64 // earliest unix nanos at which the next request may be released
+	queued       int64
+	lastReset    int64
+	allowedCount int64
+	deniedCount  int64
+	slots        map[*leakySlot]struct{} // slots of the queued callers
+	changed      notifier
+	closed       closer
+	clock        Clock
+	mu           sync.Mutex
+}
+
+// leakySlot is the time span a queued caller is released in
+type leakySlot struct {
+	start int64
+	end   int64
+}
+
+func NewLeakyBucket(config *Config) *LeakyBucket {
+	interval := time.Second.Nanoseconds()
+	if config.Rate > 0 {
+		interval /= int64(config.Rate)
+	}
+	clock := config.clockOrDefault()
+	now := clock.Now().UnixNano()
+	return &LeakyBucket{
+		rate:       int64(config.Rate),
+		interval:   interval,
+		queueSize:  int64(config.QueueSize),
+		maxWaiters: int64(config.MaxWaiters),
+		next:       now,
+		lastReset:  now,
+		clock:      clock,
+	}
+}
+
+func (lb *LeakyBucket) Allow() bool {
+	return lb.AllowN(1)
+}
+
+func (lb *LeakyBucket) AllowN(n int) bool {
+	return lb.AllowDecision(n).Allowed
+}
+
+// AllowDecision admits N requests only if the slot is free right now and
+// nobody is queued. Remaining is always 0, as the next slot is never free
+// right after a decision.
+func (lb *LeakyBucket) AllowDecision(n int) Decision {
+	if lb.closed.isClosed() {
+		return closedDecision()
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.clock.Now().UnixNano()
+	d := Decision{Limit: lb.rate}
+	if lb.queued == 0 && lb.next <= now {
+		lb.next = now + int64(n)*lb.interval
+		atomic.AddInt64(&lb.allowedCount, 1)
+		d.Allowed = true
+		d.ResetAt = time.Unix(0, now)
+		return d
+	}
+
+	atomic.AddInt64(&lb.deniedCount, 1)
+	retry := lb.next - now
+	if retry <= 0 {
+		// The queued callers' slots have come but they have not left the
+		// queue yet; the slot after them is at least one release away
+		retry = lb.interval
+	}
+	d.RetryAfter = time.Duration(retry)
+	d.ResetAt = time.Unix(0, now+retry)
+	return d
+}
+
+func (lb *LeakyBucket) Admit() error {
+	return lb.AdmitN(1)
+}
+
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (lb *LeakyBucket) AdmitN(n int) error {
+	if lb.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	return lb.AllowDecision(n).Err()
+}
+
+func (lb *LeakyBucket) Wait(ctx context.Context) error {
+	return lb.WaitN(ctx, 1)
+}
+
+// WaitN schedules N requests into the next free slot and blocks until it arrives.
+// It returns ErrQueueFull without waiting if QueueSize callers are already queued,
+// or ErrTooManyWaiters if MaxWaiters are, or a *DeadlineError if its slot is
+// after the context deadline.
+func (lb *LeakyBucket) WaitN(ctx context.Context, n int) error {
+	if lb.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+
+	lb.mu.Lock()
+	now := lb.clock.Now().UnixNano()
+	slot := lb.next
+	if slot < now {
+		slot = now
+	}
+	if err := checkDeadline(ctx, time.Unix(0, now), time.Duration(slot-now)); err != nil {
+		lb.mu.Unlock()
+		atomic.AddInt64(&lb.deniedCount, 1)
+		return err
+	}
+	if slot > now && lb.queued >= lb.queueSize {
+		lb.mu.Unlock()
+		atomic.AddInt64(&lb.deniedCount, 1)
+		return ErrQueueFull
+	}
+	if slot > now && lb.maxWaiters > 0 && lb.queued >= lb.maxWaiters {
+		lb.mu.Unlock()
+		atomic.AddInt64(&lb.deniedCount, 1)
+		return ErrTooManyWaiters
+	}
+	lb.next = slot + int64(n)*lb.interval
+	if slot == now {
+		lb.mu.Unlock()
+		atomic.AddInt64(&lb.allowedCount, 1)
+		return nil
+	}
+	ls := &leakySlot{start: slot, end: lb.next}
+	if lb.slots == nil {
+		lb.slots = make(map[*leakySlot]struct{})
+	}
+	lb.slots[ls] = struct{}{}
+	lb.queued++
+	changed := lb.changed.wait()
+	lb.mu.Unlock()
+
+	timer := lb.clock.NewTimer(time.Duration(slot - now))
+	defer func() { timer.Stop() }()
+
+	for {
+		select {
+		case <-timer.C():
+			lb.mu.Lock()
+			if delay := ls.start - lb.clock.Now().UnixNano(); delay > 0 {
+				// The slot was moved by a rate change
+				lb.mu.Unlock()
+				timer = lb.clock.NewTimer(time.Duration(delay))
+				continue
+			}
+			lb.dequeue(ls)
+			lb.mu.Unlock()
+			atomic.AddInt64(&lb.allowedCount, 1)
+			return nil
+		case <-changed:
+			lb.mu.Lock()
+			changed = lb.changed.wait()
+			delay := max(ls.start-lb.clock.Now().UnixNano(), 0)
+			lb.mu.Unlock()
+			timer.Stop()
+			timer = lb.clock.NewTimer(time.Duration(delay))
+		case <-ctx.Done():
+			lb.mu.Lock()
+			lb.dequeue(ls)
+			if lb.next == ls.end {
+				// Nobody was scheduled after us, so the slot can be handed back
+				lb.next = ls.start
+			}
+			lb.mu.Unlock()
+			atomic.AddInt64(&lb.deniedCount, 1)
+			return ctx.Err()
+		case <-lb.closed.done():
+			lb.mu.Lock()
+			lb.dequeue(ls)
+			lb.mu.Unlock()
+			atomic.AddInt64(&lb.deniedCount, 1)
+			return ErrLimiterClosed
+		}
+	}
+}
+
+// dequeue removes a caller that has left the queue; the caller holds lb.mu
+func (lb *LeakyBucket) dequeue(ls *leakySlot) {
+	delete(lb.slots, ls)
+	lb.queued--
+}
+
+// Reset empties the bucket. Callers already queued keep their order but are
+// rescheduled back to back starting now, so nobody can overtake them.
+func (lb *LeakyBucket) Reset() {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	now := lb.clock.Now().UnixNano()
+	queue := make([]*leakySlot, 0, len(lb.slots))
+	for ls := range lb.slots {
+		queue = append(queue, ls)
+	}
+	slices.SortFunc(queue, func(a, b *leakySlot) int { return cmp.Compare(a.start, b.start) })
+
+	lb.next = now
+	for _, ls := range queue {
+		ls.start, ls.end = lb.next, lb.next+ls.end-ls.start
+		lb.next = ls.end
+	}
+	if len(queue) > 0 {
+		lb.changed.notify()
+	}
+	lb.lastReset = now
+	atomic.StoreInt64(&lb.allowedCount, 0)
+	atomic.StoreInt64(&lb.deniedCount, 0)
+}
+
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (lb *LeakyBucket) Close() error {
+	lb.closed.close()
+	return nil
+}
+
+// SetRate changes the release rate. The queue is rescheduled at the new rate:
+// callers already queued keep their place in it, but their slots move closer
+// when the rate is raised and further away when it is lowered.
+func (lb *LeakyBucket) SetRate(rate int) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	oldInterval := lb.interval
+	lb.rate = int64(rate)
+	lb.interval = time.Second.Nanoseconds()
+	if rate > 0 {
+		lb.interval /= int64(rate)
+	}
+
+	now := lb.clock.Now().UnixNano()
+	scale := func(t int64) int64 {
+		if t <= now {
+			return t
+		}
+		return now + int64(float64(t-now)*float64(lb.interval)/float64(oldInterval))
+	}
+	lb.next = scale(lb.next)
+	for ls := range lb.slots {
+		ls.start = scale(ls.start)
+		ls.end = scale(ls.end)
+	}
+	lb.changed.notify()
+}
+
+// SetBurst has no effect; a LeakyBucket does not allow bursts
+func (lb *LeakyBucket) SetBurst(int) {}
+
+// SetCapacity has no effect on a LeakyBucket
+func (lb *LeakyBucket) SetCapacity(int) {}
+
+// SetWindow has no effect; a LeakyBucket releases requests continuously
+func (lb *LeakyBucket) SetWindow(time.Duration) {}
+
+func (lb *LeakyBucket) GetMetrics() Metrics {
+	lb.mu.Lock()
+	lastReset := lb.lastReset
+	rate := lb.rate
+	interval := lb.interval
+	queued := lb.queued
+	lb.mu.Unlock()
+
+	return Metrics{
+		TotalRequests:   atomic.LoadInt64(&lb.allowedCount) + atomic.LoadInt64(&lb.deniedCount),
+		AllowedRequests: atomic.LoadInt64(&lb.allowedCount),
+		DeniedRequests:  atomic.LoadInt64(&lb.deniedCount),
+		CurrentRate:     rate,
+		LastResetTime:   lastReset,
+		TotalWaitTime:   0, // LeakyBucket doesn't track wait time
+		MaxWaitTime:     0, // LeakyBucket doesn't track max wait time
+		WindowDuration:  time.Duration(interval),
+		InnerRate:       0, // Not applicable for LeakyBucket
+		InnerWindow:     0, // Not applicable for LeakyBucket
+		QueueDepth:      queued,
+	}
+}
+
+// QueueLength returns the number of callers currently waiting for their slot
+func (lb *LeakyBucket) QueueLength() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return int(lb.queued)
+}
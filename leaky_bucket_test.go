@@ -0,0 +1,188 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"github.com/popeskul/ratelimiter"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeakyBucket(t *testing.T) {
+	t.Run("Basic Allow", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(ratelimiter.LeakyBucketAlgorithm),
+			ratelimiter.WithRate(10),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+
+		if !limiter.Allow() {
+			t.Error("First request should be allowed")
+		}
+		if limiter.Allow() {
+			t.Error("Second request should be denied until the next slot")
+		}
+
+		time.Sleep(110 * time.Millisecond)
+
+		if !limiter.Allow() {
+			t.Error("Request should be allowed in the next slot")
+		}
+	})
+
+	t.Run("Steady Rate", func(t *testing.T) {
+		limiter := ratelimiter.NewLeakyBucket(&ratelimiter.Config{
+			Rate:      20,
+			QueueSize: 10,
+		})
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var released []time.Time
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := limiter.Wait(context.Background()); err != nil {
+					t.Errorf("Wait should not error: %v", err)
+					return
+				}
+				mu.Lock()
+				released = append(released, time.Now())
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+
+		// 5 requests at 20/s: the last one leaves 4 intervals of 50ms after the first
+		if duration := time.Since(start); duration < 190*time.Millisecond {
+			t.Errorf("Expected releases spread over at least 190ms, got %v", duration)
+		}
+		if len(released) != 5 {
+			t.Errorf("Expected 5 released requests, got %d", len(released))
+		}
+	})
+
+	t.Run("Queue Full", func(t *testing.T) {
+		limiter := ratelimiter.NewLeakyBucket(&ratelimiter.Config{
+			Rate:      10,
+			QueueSize: 1,
+		})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatalf("First Wait should not error: %v", err)
+		}
+
+		queued := make(chan error, 1)
+		go func() { queued <- limiter.Wait(ctx) }()
+
+		deadline := time.Now().Add(time.Second)
+		for limiter.QueueLength() != 1 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+
+		if err := limiter.Wait(ctx); !errors.Is(err, ratelimiter.ErrQueueFull) {
+			t.Errorf("Expected ErrQueueFull, got %v", err)
+		}
+		if err := <-queued; err != nil {
+			t.Errorf("Queued Wait should not error: %v", err)
+		}
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		limiter := ratelimiter.NewLeakyBucket(&ratelimiter.Config{
+			Rate:      1,
+			QueueSize: 10,
+		})
+
+		limiter.Allow()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := limiter.Wait(ctx); err == nil {
+			t.Error("Wait should time out")
+		}
+		if limiter.QueueLength() != 0 {
+			t.Errorf("Expected empty queue after cancellation, got %d", limiter.QueueLength())
+		}
+	})
+
+	t.Run("Reset With Queued Callers", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(time.Now())
+		limiter := ratelimiter.NewLeakyBucket(&ratelimiter.Config{
+			Rate:      1,
+			QueueSize: 10,
+			Clock:     clock,
+		})
+		limiter.Allow()
+
+		first := make(chan error, 1)
+		go func() { first <- limiter.Wait(context.Background()) }()
+		clock.BlockUntil(1)
+		second := make(chan error, 1)
+		go func() { second <- limiter.Wait(context.Background()) }()
+		clock.BlockUntil(2)
+
+		limiter.Reset()
+		select {
+		case err := <-first:
+			if err != nil {
+				t.Errorf("First queued Wait should not error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Reset should release the head of the queue")
+		}
+
+		d := limiter.AllowDecision(1)
+		if d.Allowed {
+			t.Error("Allow should not overtake a queued caller after Reset")
+		}
+		if d.RetryAfter != 2*time.Second {
+			t.Errorf("Expected to retry after the queue drains in 2s, got %v", d.RetryAfter)
+		}
+
+		clock.Advance(2 * time.Second)
+		select {
+		case err := <-second:
+			if err != nil {
+				t.Errorf("Second queued Wait should not error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("The second caller should be released once its slot arrives")
+		}
+	})
+
+	t.Run("GetMetrics", func(t *testing.T) {
+		limiter := ratelimiter.NewLeakyBucket(&ratelimiter.Config{
+			Rate:      10,
+			QueueSize: 10,
+		})
+
+		for i := 0; i < 3; i++ {
+			limiter.Allow()
+		}
+
+		metrics := limiter.GetMetrics()
+		if metrics.AllowedRequests != 1 {
+			t.Errorf("Expected 1 allowed request, got %d", metrics.AllowedRequests)
+		}
+		if metrics.DeniedRequests != 2 {
+			t.Errorf("Expected 2 denied requests, got %d", metrics.DeniedRequests)
+		}
+		if metrics.CurrentRate != 10 {
+			t.Errorf("Expected current rate 10, got %d", metrics.CurrentRate)
+		}
+
+		limiter.Reset()
+		if !limiter.Allow() {
+			t.Error("Request should be allowed after reset")
+		}
+	})
+}
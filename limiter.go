@@ -2,6 +2,7 @@ package ratelimiter
 
 import (
 	"context"
+	"time"
 )
 
 type Limiter interface {
@@ -24,31 +25,79 @@ type Limiter interface {
 	GetMetrics() Metrics
 }
 
+// Closer is implemented by limiters that hold blocked callers or other
+// resources which have to be released when the limiter is no longer used
+type Closer interface {
+	// Close wakes every blocked Wait with ErrLimiterClosed and rejects later calls
+	Close() error
+}
+
+// Admitter is implemented by limiters that explain why a request was denied
+type Admitter interface {
+	// Admit admits a single request or returns a *RateLimitError
+	Admit() error
+
+	// AdmitN admits N requests or returns a *RateLimitError
+	AdmitN(n int) error
+
+	// AllowDecision admits N requests if possible and reports the decision
+	// together with the limiter state it was made against
+	AllowDecision(n int) Decision
+}
+
+// Tunable is implemented by limiters whose limits can be changed at runtime
+// without losing their accumulated state. Setters for parameters an algorithm
+// does not use have no effect. Callers blocked in Wait are woken up to re-check
+// against the new limits.
+type Tunable interface {
+	// SetRate changes the number of allowed requests per unit of time
+	SetRate(rate int)
+
+	// SetBurst changes the maximum number of requests that can be executed at once
+	SetBurst(burst int)
+
+	// SetCapacity changes the maximum number of tokens in the bucket
+	SetCapacity(capacity int)
+
+	// SetWindow changes the time window
+	SetWindow(window time.Duration)
+}
+
+// closeLimiter closes limiter if it is a Closer
+func closeLimiter(limiter Limiter) error {
+	if closer, ok := limiter.(Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
 func New(opts ...Option) (Limiter, error) {
 	config := DefaultConfig()
 	for _, opt := range opts {
 		opt(config)
 	}
 
-	var limiter Limiter
-	var err error
-
-	switch config.Algorithm {
-	case "token_bucket":
-		limiter = NewTokenBucket(config)
-	case "fixed_window":
-		limiter = NewFixedWindow(config)
-	case "sliding_window":
-		limiter = NewSlidingWindow(config)
-	case "nested_window":
-		limiter = NewNestedWindow(config)
-	default:
+	return newLimiter(config)
+}
+
+// newLimiter validates an already populated config and builds the limiter it describes
+func newLimiter(config *Config) (Limiter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	factory, ok := lookupAlgorithm(config.Algorithm)
+	if !ok {
 		return nil, ErrUnsupportedAlgorithm
 	}
+	limiter, err := factory(config)
+	if err != nil {
+		return nil, err
+	}
 
 	if config.MetricsEnabled {
-		limiter = NewMetricsWrapper(limiter, NewMetricsCollector())
+		limiter = wrapMetrics(limiter, NewMetricsCollector(), config.clockOrDefault())
 	}
 
-	return limiter, err
+	return limiter, nil
 }
@@ -17,6 +17,11 @@ type Metrics struct {
 	WindowDuration  time.Duration
 	InnerRate       int64
 	InnerWindow     time.Duration
+	Remaining       int64 // Requests that would be allowed right now; negative while in debt
+	InFlight        int64 // Leases currently held (for ConcurrencyLimiter)
+	PeakInFlight    int64 // Highest number of leases held at once (for ConcurrencyLimiter)
+	MaxInFlight     int64 // Maximum number of concurrent leases (for ConcurrencyLimiter)
+	QueueDepth      int64 // Callers currently blocked in Wait
 }
 
 // MetricsCollector collects metrics for the rate limiter
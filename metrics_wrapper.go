@@ -9,12 +9,14 @@ import (
 type MetricsWrapper struct {
 	limiter   Limiter
 	collector MetricsCollector
+	clock     Clock
 }
 
 func NewMetricsWrapper(limiter Limiter, collector MetricsCollector) *MetricsWrapper {
 	return &MetricsWrapper{
 		limiter:   limiter,
 		collector: collector,
+		clock:     SystemClock(),
 	}
 }
 
@@ -42,11 +44,11 @@ func (mw *MetricsWrapper) AllowN(n int) bool {
 
 func (mw *MetricsWrapper) Wait(ctx context.Context) error {
 	mw.collector.IncrementTotalRequests()
-	start := time.Now()
+	start := mw.clock.Now()
 	err := mw.limiter.Wait(ctx)
 	if err == nil {
 		mw.collector.IncrementAllowedRequests()
-		mw.collector.RecordWaitTime(time.Since(start))
+		mw.collector.RecordWaitTime(mw.clock.Now().Sub(start))
 	} else {
 		mw.collector.IncrementDeniedRequests()
 	}
@@ -55,22 +57,136 @@ func (mw *MetricsWrapper) Wait(ctx context.Context) error {
 
 func (mw *MetricsWrapper) WaitN(ctx context.Context, n int) error {
 	mw.collector.IncrementTotalRequests()
-	start := time.Now()
+	start := mw.clock.Now()
 	err := mw.limiter.WaitN(ctx, n)
 	if err == nil {
 		mw.collector.IncrementAllowedRequests()
-		mw.collector.RecordWaitTime(time.Since(start))
+		mw.collector.RecordWaitTime(mw.clock.Now().Sub(start))
 	} else {
 		mw.collector.IncrementDeniedRequests()
 	}
 	return err
 }
 
+func (mw *MetricsWrapper) Admit() error {
+	return mw.AdmitN(1)
+}
+
+// AdmitN admits N requests on the wrapped limiter. If the wrapped limiter is
+// not an Admitter, denials are reported as a RateLimitError without details,
+// whose RetryAfter is InfDuration as the time to retry is unknown.
+func (mw *MetricsWrapper) AdmitN(n int) error {
+	mw.collector.IncrementTotalRequests()
+	var err error
+	if admitter, ok := mw.limiter.(Admitter); ok {
+		err = admitter.AdmitN(n)
+	} else if !mw.limiter.AllowN(n) {
+		err = &RateLimitError{RetryAfter: InfDuration}
+	}
+	if err == nil {
+		mw.collector.IncrementAllowedRequests()
+	} else {
+		mw.collector.IncrementDeniedRequests()
+	}
+	return err
+}
+
+// AllowDecision admits N requests on the wrapped limiter. If the wrapped
+// limiter is not an Admitter, the decision only says whether they were
+// allowed, and a denial retries after InfDuration as the time is unknown.
+func (mw *MetricsWrapper) AllowDecision(n int) Decision {
+	mw.collector.IncrementTotalRequests()
+	var d Decision
+	if admitter, ok := mw.limiter.(Admitter); ok {
+		d = admitter.AllowDecision(n)
+	} else if d.Allowed = mw.limiter.AllowN(n); !d.Allowed {
+		d.RetryAfter = InfDuration
+	}
+	if d.Allowed {
+		mw.collector.IncrementAllowedRequests()
+	} else {
+		mw.collector.IncrementDeniedRequests()
+	}
+	return d
+}
+
+// reservingMetricsWrapper is the MetricsWrapper of a limiter that is a
+// Reserver, so that the wrapper is only a Reserver when the wrapped limiter is
+type reservingMetricsWrapper struct {
+	*MetricsWrapper
+	reserver Reserver
+}
+
+// wrapMetrics wraps limiter in a MetricsWrapper timed by clock that keeps
+// its Reserver implementation, if it has one
+func wrapMetrics(limiter Limiter, collector MetricsCollector, clock Clock) Limiter {
+	wrapper := NewMetricsWrapper(limiter, collector)
+	wrapper.clock = clock
+	if reserver, ok := limiter.(Reserver); ok {
+		return &reservingMetricsWrapper{MetricsWrapper: wrapper, reserver: reserver}
+	}
+	return wrapper
+}
+
+func (rw *reservingMetricsWrapper) Reserve() *Reservation {
+	return rw.ReserveN(1)
+}
+
+// ReserveN reserves N requests on the wrapped limiter
+func (rw *reservingMetricsWrapper) ReserveN(n int) *Reservation {
+	rw.collector.IncrementTotalRequests()
+	r := rw.reserver.ReserveN(n)
+	if r.OK() {
+		rw.collector.IncrementAllowedRequests()
+	} else {
+		rw.collector.IncrementDeniedRequests()
+	}
+	return r
+}
+
+// SetRate changes the rate of the wrapped limiter if it is Tunable
+func (mw *MetricsWrapper) SetRate(rate int) {
+	if tunable, ok := mw.limiter.(Tunable); ok {
+		tunable.SetRate(rate)
+		mw.collector.UpdateCurrentRate(int64(rate))
+	}
+}
+
+// SetBurst changes the burst of the wrapped limiter if it is Tunable
+func (mw *MetricsWrapper) SetBurst(burst int) {
+	if tunable, ok := mw.limiter.(Tunable); ok {
+		tunable.SetBurst(burst)
+	}
+}
+
+// SetCapacity changes the capacity of the wrapped limiter if it is Tunable
+func (mw *MetricsWrapper) SetCapacity(capacity int) {
+	if tunable, ok := mw.limiter.(Tunable); ok {
+		tunable.SetCapacity(capacity)
+	}
+}
+
+// SetWindow changes the window of the wrapped limiter if it is Tunable
+func (mw *MetricsWrapper) SetWindow(window time.Duration) {
+	if tunable, ok := mw.limiter.(Tunable); ok {
+		tunable.SetWindow(window)
+	}
+}
+
 func (mw *MetricsWrapper) Reset() {
 	mw.limiter.Reset()
 	mw.collector.Reset()
 }
 
+// Close closes the wrapped limiter if it is a Closer
+func (mw *MetricsWrapper) Close() error {
+	return closeLimiter(mw.limiter)
+}
+
 func (mw *MetricsWrapper) GetMetrics() Metrics {
-	return mw.collector.GetMetrics()
+	metrics := mw.collector.GetMetrics()
+	inner := mw.limiter.GetMetrics()
+	metrics.Remaining = inner.Remaining
+	metrics.QueueDepth = inner.QueueDepth
+	return metrics
 }
@@ -8,31 +8,38 @@ import (
 )
 
 type NestedWindow struct {
-	outerRate        int64
-	innerRate        int64
-	outerWindow      time.Duration
-	innerWindow      time.Duration
-	outerCount       int64
-	innerCount       int64
-	outerWindowStart int64
-	innerWindowStart int64
-	totalRequests    int64
-	allowedCount     int64
-	deniedCount      int64
-	mu               sync.Mutex
+	outerRate     int64
+	innerRate     int64
+	outerWindow   time.Duration
+	innerWindow   time.Duration
+	outer         windowCounter
+	inner         windowCounter
+	totalRequests int64
+	allowedCount  int64
+	deniedCount   int64
+	changed       notifier
+	closed        closer
+	waiters       waitQueue
+	clock         Clock
+	mu            sync.Mutex
 }
 
 func NewNestedWindow(config *Config) *NestedWindow {
-	now := time.Now().UnixNano()
+	clock := config.clockOrDefault()
+	now := clock.Now().UnixNano()
+	innerWindow := config.InnerWindow
+	if innerWindow <= 0 {
+		innerWindow = config.Window / 10 // Inner window defaults to 1/10th of the outer window
+	}
 	return &NestedWindow{
-		outerRate:        int64(config.Rate),
-		innerRate:        int64(config.Burst),
-		outerWindow:      config.Window,
-		innerWindow:      config.Window / 10, // Inner window is 1/10th of the outer window
-		outerCount:       0,
-		innerCount:       0,
-		outerWindowStart: now,
-		innerWindowStart: now,
+		outerRate:   int64(config.Rate),
+		innerRate:   int64(config.Burst),
+		outerWindow: config.Window,
+		innerWindow: innerWindow,
+		outer:       newWindowCounter(config.Window, now),
+		inner:       newWindowCounter(innerWindow, now),
+		clock:       clock,
+		waiters:     newWaitQueue(config.MaxWaiters),
 	}
 }
 
@@ -41,78 +48,180 @@ func (nw *NestedWindow) Allow() bool {
 }
 
 func (nw *NestedWindow) AllowN(n int) bool {
+	return nw.AllowDecision(n).Allowed
+}
+
+// AllowDecision admits N requests if both windows have room for them. Limit,
+// Remaining and ResetAt describe the window that denied the request, or
+// otherwise the one with the least room left.
+func (nw *NestedWindow) AllowDecision(n int) Decision {
+	if nw.closed.isClosed() {
+		return closedDecision()
+	}
+
 	nw.mu.Lock()
 	defer nw.mu.Unlock()
 
 	atomic.AddInt64(&nw.totalRequests, 1)
 
-	now := time.Now().UnixNano()
+	now := nw.clock.Now().UnixNano()
 	nw.updateWindows(now)
 
-	if nw.outerCount+int64(n) > nw.outerRate || nw.innerCount+int64(n) > nw.innerRate {
+	var d Decision
+	switch {
+	case nw.outer.count+int64(n) > nw.outerRate:
+		d.DeniedBy = ScopeOuter
+	case nw.inner.count+int64(n) > nw.innerRate:
+		d.DeniedBy = ScopeInner
+	default:
+		nw.outer.count += int64(n)
+		nw.inner.count += int64(n)
+		atomic.AddInt64(&nw.allowedCount, 1)
+		d.Allowed = true
+	}
+	if !d.Allowed {
 		atomic.AddInt64(&nw.deniedCount, 1)
-		return false
+		var err error
+		if d.RetryAfter, err = nw.timeToAllow(now, n); err != nil {
+			d.RetryAfter = InfDuration
+		}
 	}
 
-	nw.outerCount += int64(n)
-	nw.innerCount += int64(n)
-	atomic.AddInt64(&nw.allowedCount, 1)
-	return true
+	innerRemaining := nw.innerRate - nw.inner.count
+	outerRemaining := nw.outerRate - nw.outer.count
+	if d.DeniedBy == ScopeInner || (d.Allowed && innerRemaining < outerRemaining) {
+		d.Limit = nw.innerRate
+		d.Remaining = max(innerRemaining, 0)
+		d.ResetAt = time.Unix(0, nw.inner.start+nw.inner.window)
+	} else {
+		d.Limit = nw.outerRate
+		d.Remaining = max(outerRemaining, 0)
+		d.ResetAt = time.Unix(0, nw.outer.start+nw.outer.window)
+	}
+	return d
 }
 
-func (nw *NestedWindow) Wait(ctx context.Context) error {
-	nw.mu.Lock()
-	defer nw.mu.Unlock()
+func (nw *NestedWindow) Admit() error {
+	return nw.AdmitN(1)
+}
 
-	atomic.AddInt64(&nw.totalRequests, 1)
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (nw *NestedWindow) AdmitN(n int) error {
+	if nw.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	return nw.AllowDecision(n).Err()
+}
 
-	timer := time.NewTimer(nw.innerWindow)
-	defer timer.Stop()
+func (nw *NestedWindow) Wait(ctx context.Context) error {
+	atomic.AddInt64(&nw.totalRequests, 1)
+	waiting := false
 
+	// The lock is only held while checking, so setters and other callers are
+	// not blocked while this one sleeps
 	for {
+		if nw.closed.isClosed() {
+			return ErrLimiterClosed
+		}
+
+		nw.mu.Lock()
 		if nw.allow() {
+			nw.mu.Unlock()
 			atomic.AddInt64(&nw.allowedCount, 1)
 			return nil
 		}
+		now := nw.clock.Now()
+		delay, err := nw.timeToAllow(now.UnixNano(), 1)
+		nw.mu.Unlock()
 
-		atomic.AddInt64(&nw.deniedCount, 1)
+		if err == nil {
+			err = checkDeadline(ctx, now, delay)
+		}
+		if err != nil {
+			atomic.AddInt64(&nw.deniedCount, 1)
+			return err
+		}
 
+		if !waiting {
+			if !nw.waiters.enter() {
+				atomic.AddInt64(&nw.deniedCount, 1)
+				return ErrTooManyWaiters
+			}
+			defer nw.waiters.leave()
+			waiting = true
+		}
+
+		timer := nw.clock.NewTimer(delay)
 		select {
-		case <-timer.C:
-			timer.Reset(nw.innerWindow)
+		case <-timer.C():
+		case <-nw.changed.wait():
+			timer.Stop()
 		case <-ctx.Done():
+			timer.Stop()
+			atomic.AddInt64(&nw.deniedCount, 1)
 			return ctx.Err()
+		case <-nw.closed.done():
+			timer.Stop()
+			atomic.AddInt64(&nw.deniedCount, 1)
+			return ErrLimiterClosed
 		}
 	}
 }
 
+// allow admits a single request; the caller holds nw.mu
 func (nw *NestedWindow) allow() bool {
-	now := time.Now().UnixNano()
+	now := nw.clock.Now().UnixNano()
 	nw.updateWindows(now)
 
-	if nw.outerCount+1 > nw.outerRate || nw.innerCount+1 > nw.innerRate {
+	if nw.outer.count+1 > nw.outerRate || nw.inner.count+1 > nw.innerRate {
 		return false
 	}
 
-	nw.outerCount++
-	nw.innerCount++
+	nw.outer.count++
+	nw.inner.count++
 	return true
 }
 
 func (nw *NestedWindow) WaitN(ctx context.Context, n int) error {
-	timer := time.NewTimer(nw.innerWindow)
-	defer timer.Stop()
-
+	waiting := false
 	for {
+		if nw.closed.isClosed() {
+			return ErrLimiterClosed
+		}
 		if nw.AllowN(n) {
 			return nil
 		}
 
+		nw.mu.Lock()
+		now := nw.clock.Now()
+		delay, err := nw.timeToAllow(now.UnixNano(), n)
+		nw.mu.Unlock()
+
+		if err == nil {
+			err = checkDeadline(ctx, now, delay)
+		}
+		if err != nil {
+			return err
+		}
+		if !waiting {
+			if !nw.waiters.enter() {
+				return ErrTooManyWaiters
+			}
+			defer nw.waiters.leave()
+			waiting = true
+		}
+
+		timer := nw.clock.NewTimer(delay)
 		select {
-		case <-timer.C:
-			timer.Reset(nw.innerWindow)
+		case <-timer.C():
+		case <-nw.changed.wait():
+			timer.Stop()
 		case <-ctx.Done():
+			timer.Stop()
 			return ctx.Err()
+		case <-nw.closed.done():
+			timer.Stop()
+			return ErrLimiterClosed
 		}
 	}
 }
@@ -121,39 +230,157 @@ func (nw *NestedWindow) Reset() {
 	nw.mu.Lock()
 	defer nw.mu.Unlock()
 
-	now := time.Now().UnixNano()
-	nw.outerCount = 0
-	nw.innerCount = 0
-	nw.outerWindowStart = now
-	nw.innerWindowStart = now
+	now := nw.clock.Now().UnixNano()
+	nw.outer.reset(now)
+	nw.inner.reset(now)
 	atomic.StoreInt64(&nw.totalRequests, 0)
 	atomic.StoreInt64(&nw.allowedCount, 0)
 	atomic.StoreInt64(&nw.deniedCount, 0)
 }
 
+func (nw *NestedWindow) Reserve() *Reservation {
+	return nw.ReserveN(1)
+}
+
+// ReserveN reserves N requests at the earliest time both the outer and the
+// inner window have room for them. N larger than either rate can never be satisfied.
+func (nw *NestedWindow) ReserveN(n int) *Reservation {
+	if nw.closed.isClosed() {
+		return &Reservation{}
+	}
+
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+
+	atomic.AddInt64(&nw.totalRequests, 1)
+
+	if int64(n) > nw.outerRate || int64(n) > nw.innerRate {
+		atomic.AddInt64(&nw.deniedCount, 1)
+		return &Reservation{}
+	}
+
+	now := nw.clock.Now().UnixNano()
+	nw.updateWindows(now)
+
+	t := now
+	var outerStart, innerStart int64
+	for {
+		outerStart = nw.outer.windowOf(t)
+		innerStart = nw.inner.windowOf(t)
+		if nw.outer.used(outerStart)+int64(n) > nw.outerRate {
+			t = nw.outer.after(outerStart, int64(n), nw.outerRate)
+			continue
+		}
+		if nw.inner.used(innerStart)+int64(n) > nw.innerRate {
+			t = nw.inner.after(innerStart, int64(n), nw.innerRate)
+			continue
+		}
+		break
+	}
+
+	nw.outer.add(outerStart, int64(n))
+	nw.inner.add(innerStart, int64(n))
+	atomic.AddInt64(&nw.allowedCount, 1)
+
+	return newReservation(nw.clock, n, time.Unix(0, t), func(tokens int) {
+		nw.mu.Lock()
+		defer nw.mu.Unlock()
+		nw.updateWindows(nw.clock.Now().UnixNano())
+		if tokens < 0 {
+			nw.outer.add(outerStart, int64(tokens))
+			nw.inner.add(innerStart, int64(tokens))
+		} else {
+			nw.outer.charge(outerStart, int64(tokens), nw.outerRate)
+			nw.inner.charge(innerStart, int64(tokens), nw.innerRate)
+		}
+	})
+}
+
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (nw *NestedWindow) Close() error {
+	nw.closed.close()
+	return nil
+}
+
+// SetRate changes the number of requests allowed per outer window
+func (nw *NestedWindow) SetRate(rate int) {
+	nw.mu.Lock()
+	atomic.StoreInt64(&nw.outerRate, int64(rate))
+	nw.mu.Unlock()
+	nw.changed.notify()
+}
+
+// SetBurst changes the number of requests allowed per inner window
+func (nw *NestedWindow) SetBurst(burst int) {
+	nw.mu.Lock()
+	atomic.StoreInt64(&nw.innerRate, int64(burst))
+	nw.mu.Unlock()
+	nw.changed.notify()
+}
+
+// SetCapacity has no effect on a NestedWindow
+func (nw *NestedWindow) SetCapacity(int) {}
+
+// SetWindow changes the outer window length and scales the inner window with
+// it. Both current windows keep their start and count.
+func (nw *NestedWindow) SetWindow(window time.Duration) {
+	nw.mu.Lock()
+	if nw.outerWindow > 0 {
+		nw.innerWindow = time.Duration(float64(nw.innerWindow) * float64(window) / float64(nw.outerWindow))
+	} else {
+		nw.innerWindow = window / 10
+	}
+	nw.outerWindow = window
+	nw.outer.resize(nw.outerWindow)
+	nw.inner.resize(nw.innerWindow)
+	nw.mu.Unlock()
+	nw.changed.notify()
+}
+
 func (nw *NestedWindow) GetMetrics() Metrics {
+	nw.mu.Lock()
+	nw.updateWindows(nw.clock.Now().UnixNano())
+	outerStart := nw.outer.start
+	outerWindow := nw.outerWindow
+	innerWindow := nw.innerWindow
+	remaining := min(nw.outerRate-nw.outer.count, nw.innerRate-nw.inner.count)
+	nw.mu.Unlock()
+
 	return Metrics{
 		TotalRequests:   atomic.LoadInt64(&nw.totalRequests),
 		AllowedRequests: atomic.LoadInt64(&nw.allowedCount),
 		DeniedRequests:  atomic.LoadInt64(&nw.deniedCount),
 		CurrentRate:     atomic.LoadInt64(&nw.outerRate),
-		LastResetTime:   atomic.LoadInt64(&nw.outerWindowStart),
+		LastResetTime:   outerStart,
 		TotalWaitTime:   0, // NestedWindow doesn't track wait time
 		MaxWaitTime:     0, // NestedWindow doesn't track max wait time
-		WindowDuration:  nw.outerWindow,
+		WindowDuration:  outerWindow,
 		InnerRate:       atomic.LoadInt64(&nw.innerRate),
-		InnerWindow:     nw.innerWindow,
+		InnerWindow:     innerWindow,
+		Remaining:       remaining,
+		QueueDepth:      nw.waiters.len(),
 	}
 }
 
-func (nw *NestedWindow) updateWindows(now int64) {
-	if now-nw.outerWindowStart >= nw.outerWindow.Nanoseconds() {
-		nw.outerCount = 0
-		nw.outerWindowStart = now
+// timeToAllow returns how long until N requests may fit in both windows, which
+// is no sooner than the end of whichever window is full. It returns
+// ErrExceedsLimit if N never fits; the caller holds nw.mu
+func (nw *NestedWindow) timeToAllow(now int64, n int) (time.Duration, error) {
+	if int64(n) > nw.outerRate || int64(n) > nw.innerRate {
+		return 0, ErrExceedsLimit
 	}
-
-	if now-nw.innerWindowStart >= nw.innerWindow.Nanoseconds() {
-		nw.innerCount = 0
-		nw.innerWindowStart = now
+	nw.updateWindows(now)
+	if nw.outer.count+int64(n) > nw.outerRate {
+		return nw.outer.untilNext(now), nil
+	}
+	if nw.inner.count+int64(n) > nw.innerRate {
+		return nw.inner.untilNext(now), nil
 	}
+	return 0, nil
+}
+
+func (nw *NestedWindow) updateWindows(now int64) {
+	nw.outer.advance(now)
+	nw.inner.advance(now)
 }
@@ -0,0 +1,73 @@
+package ratelimiter
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// notifier lets goroutines blocked in Wait be woken up when the limiter changes.
+// The zero value is ready to use.
+type notifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// wait returns a channel that is closed on the next notify
+func (n *notifier) wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch == nil {
+		n.ch = make(chan struct{})
+	}
+	return n.ch
+}
+
+// notify wakes every goroutine currently selecting on a channel from wait
+func (n *notifier) notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.ch != nil {
+		close(n.ch)
+		n.ch = nil
+	}
+}
+
+// closer lets Close wake every goroutine blocked in Wait and reject later calls.
+// The zero value is ready to use.
+type closer struct {
+	mu     sync.Mutex
+	ch     chan struct{}
+	closed int32
+}
+
+// done returns a channel that is closed once close has been called
+func (c *closer) done() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ch == nil {
+		c.ch = make(chan struct{})
+	}
+	return c.ch
+}
+
+// close closes the done channel; calls after the first have no effect
+func (c *closer) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return
+	}
+	if c.ch == nil {
+		c.ch = make(chan struct{})
+	}
+	close(c.ch)
+}
+
+// isClosed reports whether close has been called
+func (c *closer) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
@@ -5,10 +5,13 @@ import "time"
 type Algorithm string
 
 const (
-	TokenBucketAlgorithm   Algorithm = "token_bucket"
-	FixedWindowAlgorithm   Algorithm = "fixed_window"
-	SlidingWindowAlgorithm Algorithm = "sliding_window"
-	NestedWindowAlgorithm  Algorithm = "nested_window"
+	TokenBucketAlgorithm          Algorithm = "token_bucket"
+	FixedWindowAlgorithm          Algorithm = "fixed_window"
+	SlidingWindowAlgorithm        Algorithm = "sliding_window"
+	SlidingWindowCounterAlgorithm Algorithm = "sliding_window_counter"
+	NestedWindowAlgorithm         Algorithm = "nested_window"
+	GCRAAlgorithm                 Algorithm = "gcra"
+	LeakyBucketAlgorithm          Algorithm = "leaky_bucket"
 )
 
 // Option func is a function that takes a pointer to Config and modifies it
@@ -16,13 +19,29 @@ type Option func(*Config)
 
 // Config struct contains the configuration for the rate limiter
 type Config struct {
-	Rate           int           // Number of allowed requests per unit of time
-	Burst          int           // The maximum number of requests that can be executed at once
-	Capacity       int           // Maximum number of tokens in the bucket (for Token Bucket)
-	Window         time.Duration // Time window for window-based algorithms
-	InnerWindow    time.Duration // Inner time window for Nested Window
-	Algorithm      Algorithm     // Algorithm to use for rate limiting
-	MetricsEnabled bool          // Enable metrics for the rate limiter
+	Rate           int           `json:"rate"`          // Number of allowed requests per unit of time
+	Burst          int           `json:"burst"`         // The maximum number of requests that can be executed at once
+	Capacity       int           `json:"capacity"`      // Maximum number of tokens in the bucket (for Token Bucket)
+	Window         time.Duration `json:"window"`        // Time window for window-based algorithms
+	InnerWindow    time.Duration `json:"inner_window"`  // Inner time window for Nested Window (0 for a tenth of Window)
+	QueueSize      int           `json:"queue_size"`    // Maximum number of queued waiters (for Leaky Bucket)
+	MaxWaiters     int           `json:"max_waiters"`   // Maximum number of callers blocked in Wait at once (0 for no limit)
+	MaxInFlight    int           `json:"max_in_flight"` // Maximum number of concurrent leases (for ConcurrencyLimiter)
+	RateLimited    bool          `json:"rate_limited"`  // Also apply the Algorithm rate limit (for ConcurrencyLimiter)
+	Algorithm      Algorithm     `json:"algorithm"`     // Algorithm to use for rate limiting
+	MetricsEnabled bool          `json:"metrics"`       // Enable metrics for the rate limiter
+	KeyTTL         time.Duration `json:"key_ttl"`       // Idle time after which a key is evicted (for KeyedLimiter)
+	MaxKeys        int           `json:"max_keys"`      // Maximum number of keys kept at once (for KeyedLimiter)
+	Shards         int           `json:"shards"`        // Number of lock shards (for KeyedLimiter)
+	Clock          Clock         `json:"-"`             // Clock used to tell time (defaults to the system clock)
+}
+
+// WithConfig replaces the whole Config with a copy of config, for example one
+// loaded with ParseConfig or from JSON. Options after it still apply.
+func WithConfig(config *Config) Option {
+	return func(c *Config) {
+		*c = *config
+	}
 }
 
 // WithRate sets the Rate for Config
@@ -60,6 +79,35 @@ func WithInnerWindow(innerWindow time.Duration) Option {
 	}
 }
 
+// WithQueueSize sets the QueueSize for Config (for Leaky Bucket)
+func WithQueueSize(queueSize int) Option {
+	return func(c *Config) {
+		c.QueueSize = queueSize
+	}
+}
+
+// WithMaxWaiters sets the MaxWaiters for Config. Once that many callers are
+// blocked in Wait, further callers fail fast with ErrTooManyWaiters.
+func WithMaxWaiters(maxWaiters int) Option {
+	return func(c *Config) {
+		c.MaxWaiters = maxWaiters
+	}
+}
+
+// WithMaxInFlight sets the MaxInFlight for Config (for ConcurrencyLimiter)
+func WithMaxInFlight(maxInFlight int) Option {
+	return func(c *Config) {
+		c.MaxInFlight = maxInFlight
+	}
+}
+
+// WithRateLimited sets the RateLimited for Config (for ConcurrencyLimiter)
+func WithRateLimited(enabled bool) Option {
+	return func(c *Config) {
+		c.RateLimited = enabled
+	}
+}
+
 // WithAlgorithm sets the Algorithm for Config
 func WithAlgorithm(algo Algorithm) Option {
 	return func(c *Config) {
@@ -74,6 +122,42 @@ func WithMetrics(enabled bool) Option {
 	}
 }
 
+// WithKeyTTL sets the KeyTTL for Config (for KeyedLimiter)
+func WithKeyTTL(ttl time.Duration) Option {
+	return func(c *Config) {
+		c.KeyTTL = ttl
+	}
+}
+
+// WithMaxKeys sets the MaxKeys for Config (for KeyedLimiter)
+func WithMaxKeys(maxKeys int) Option {
+	return func(c *Config) {
+		c.MaxKeys = maxKeys
+	}
+}
+
+// WithShards sets the Shards for Config (for KeyedLimiter)
+func WithShards(shards int) Option {
+	return func(c *Config) {
+		c.Shards = shards
+	}
+}
+
+// WithClock sets the Clock for Config
+func WithClock(clock Clock) Option {
+	return func(c *Config) {
+		c.Clock = clock
+	}
+}
+
+// clockOrDefault returns the configured Clock, or the system clock if none is set
+func (c *Config) clockOrDefault() Clock {
+	if c.Clock == nil {
+		return SystemClock()
+	}
+	return c.Clock
+}
+
 // DefaultConfig returns the default configuration for the rate limiter
 func DefaultConfig() *Config {
 	return &Config{
@@ -81,8 +165,15 @@ func DefaultConfig() *Config {
 		Burst:          1,
 		Capacity:       100,
 		Window:         time.Minute,
-		InnerWindow:    time.Second * 6,
+		InnerWindow:    0,
+		QueueSize:      100,
+		MaxWaiters:     0,
+		MaxInFlight:    100,
+		RateLimited:    false,
 		Algorithm:      "token_bucket",
 		MetricsEnabled: false,
+		KeyTTL:         0,
+		MaxKeys:        0,
+		Shards:         16,
 	}
 }
@@ -0,0 +1,272 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Attributes describe a request for matching against policy rules
+type Attributes struct {
+	Tenant string            // who is making the request
+	Plan   string            // the tenant's plan, such as "free" or "paid"
+	Route  string            // the route or path requested
+	Method string            // the request method
+	Labels map[string]string // any other attributes
+}
+
+// Match selects the requests a Rule applies to. Empty fields match anything.
+// Route is a path.Match pattern such as "/search" or "/api/*"; the other
+// fields and every label must match exactly.
+type Match struct {
+	Tenant string            `json:"tenant,omitempty"`
+	Plan   string            `json:"plan,omitempty"`
+	Route  string            `json:"route,omitempty"`
+	Method string            `json:"method,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// matches reports whether attrs satisfy every criterion of m
+func (m *Match) matches(attrs Attributes) bool {
+	if m.Tenant != "" && m.Tenant != attrs.Tenant ||
+		m.Plan != "" && m.Plan != attrs.Plan ||
+		m.Method != "" && !strings.EqualFold(m.Method, attrs.Method) {
+		return false
+	}
+	if m.Route != "" {
+		if ok, _ := path.Match(m.Route, attrs.Route); !ok {
+			return false
+		}
+	}
+	for name, value := range m.Labels {
+		if v, ok := attrs.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// specificity counts the criteria of m; a more specific Match constrains more
+func (m *Match) specificity() int {
+	n := len(m.Labels)
+	for _, field := range []string{m.Tenant, m.Plan, m.Route, m.Method} {
+		if field != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Rule limits the requests its Match selects with the limiter its Config
+// describes, or not at all if Unlimited is set. Every distinct key gets its own
+// limiter; KeyBy names the attributes the key is built from ("tenant", "plan",
+// "route", "method" or "label:<name>") and defaults to the tenant.
+type Rule struct {
+	Name      string   `json:"name"`
+	Match     Match    `json:"match"`
+	Config    *Config  `json:"config,omitempty"`
+	Unlimited bool     `json:"unlimited,omitempty"`
+	KeyBy     []string `json:"key_by,omitempty"`
+}
+
+// UnmarshalJSON decodes a Rule, decoding its Config on top of DefaultConfig.
+// A rule without a config is left without one, so that NewPolicy rejects it
+// unless it is Unlimited.
+func (r *Rule) UnmarshalJSON(data []byte) error {
+	type plain Rule
+	var raw struct {
+		Config json.RawMessage `json:"config"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if r.Config == nil && len(raw.Config) > 0 && string(raw.Config) != "null" {
+		r.Config = DefaultConfig()
+	}
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+// MatchMode decides which rule applies when several match a request
+type MatchMode int
+
+const (
+	// FirstMatch applies the first matching rule in order
+	FirstMatch MatchMode = iota
+	// MostSpecific applies the matching rule with the most criteria, and the
+	// first of those in order on a tie
+	MostSpecific
+)
+
+// Evaluation reports which rule a request matched
+type Evaluation struct {
+	Matched   bool   // whether any rule matched; requests matching none are not limited
+	Rule      string // name of the matching rule
+	Index     int    // position of the matching rule, or -1
+	Key       string // key of the limiter within the rule: the KeyBy attribute values joined by NUL bytes
+	Unlimited bool   // whether the request is not limited, by the rule or for lack of one
+}
+
+// Policy limits requests according to ordered rules matched against their
+// Attributes. Requests that match no rule are not limited.
+type Policy struct {
+	mode  MatchMode
+	rules []policyRule
+}
+
+type policyRule struct {
+	Rule
+	index   int
+	limiter *KeyedLimiter
+}
+
+// NewPolicy validates the rules and builds a KeyedLimiter for each limited one
+func NewPolicy(mode MatchMode, rules ...Rule) (*Policy, error) {
+	p := &Policy{mode: mode, rules: make([]policyRule, 0, len(rules))}
+	for i, rule := range rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("rule %d", i)
+		}
+		if len(rule.KeyBy) == 0 {
+			rule.KeyBy = []string{"tenant"}
+		}
+		if err := validateRule(&rule); err != nil {
+			// The limiters built so far were never handed out
+			_ = p.Close()
+			return nil, err
+		}
+
+		pr := policyRule{Rule: rule, index: i}
+		if !rule.Unlimited {
+			limiter, err := NewKeyedLimiter(WithConfig(rule.Config))
+			if err != nil {
+				_ = p.Close()
+				return nil, fmt.Errorf("ratelimiter: rule %q: %w", rule.Name, err)
+			}
+			pr.limiter = limiter
+		}
+		p.rules = append(p.rules, pr)
+	}
+	return p, nil
+}
+
+// validateRule checks the parts of a rule that NewKeyedLimiter does not
+func validateRule(rule *Rule) error {
+	if !rule.Unlimited && rule.Config == nil {
+		return fmt.Errorf("%w: rule %q has no Config and is not Unlimited", ErrInvalidConfig, rule.Name)
+	}
+	if _, err := path.Match(rule.Match.Route, ""); err != nil {
+		return fmt.Errorf("%w: rule %q: route %q: %v", ErrInvalidConfig, rule.Name, rule.Match.Route, err)
+	}
+	for _, attr := range rule.KeyBy {
+		switch {
+		case attr == "tenant", attr == "plan", attr == "route", attr == "method":
+		case strings.HasPrefix(attr, "label:"):
+		default:
+			return fmt.Errorf("%w: rule %q: unknown key attribute %q", ErrInvalidConfig, rule.Name, attr)
+		}
+	}
+	return nil
+}
+
+// Evaluate reports which rule applies to a request without counting it
+func (p *Policy) Evaluate(attrs Attributes) Evaluation {
+	rule := p.match(attrs)
+	if rule == nil {
+		return Evaluation{Index: -1, Unlimited: true}
+	}
+	return Evaluation{
+		Matched:   true,
+		Rule:      rule.Name,
+		Index:     rule.index,
+		Key:       rule.key(attrs),
+		Unlimited: rule.Unlimited,
+	}
+}
+
+// Limiter returns the limiter that applies to a request, or nil if the
+// request is not limited
+func (p *Policy) Limiter(attrs Attributes) Limiter {
+	rule := p.match(attrs)
+	if rule == nil || rule.Unlimited {
+		return nil
+	}
+	return rule.limiter.Limiter(rule.key(attrs))
+}
+
+// Allow checks if a request is allowed
+func (p *Policy) Allow(attrs Attributes) bool {
+	return p.AllowN(attrs, 1)
+}
+
+// AllowN checks if N requests are allowed
+func (p *Policy) AllowN(attrs Attributes, n int) bool {
+	if limiter := p.Limiter(attrs); limiter != nil {
+		return limiter.AllowN(n)
+	}
+	return true
+}
+
+// Wait blocks until a request is allowed
+func (p *Policy) Wait(ctx context.Context, attrs Attributes) error {
+	return p.WaitN(ctx, attrs, 1)
+}
+
+// WaitN blocks until N requests are allowed
+func (p *Policy) WaitN(ctx context.Context, attrs Attributes, n int) error {
+	if limiter := p.Limiter(attrs); limiter != nil {
+		return limiter.WaitN(ctx, n)
+	}
+	return nil
+}
+
+// Close closes the limiters of every rule and returns their errors joined.
+func (p *Policy) Close() error {
+	var errs []error
+	for _, rule := range p.rules {
+		if rule.limiter != nil {
+			errs = append(errs, rule.limiter.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// match returns the rule that applies to attrs, or nil if none does
+func (p *Policy) match(attrs Attributes) *policyRule {
+	var best *policyRule
+	for i := range p.rules {
+		rule := &p.rules[i]
+		if !rule.Match.matches(attrs) {
+			continue
+		}
+		if p.mode == FirstMatch {
+			return rule
+		}
+		if best == nil || rule.Match.specificity() > best.Match.specificity() {
+			best = rule
+		}
+	}
+	return best
+}
+
+// key builds the limiter key for attrs from the rule's KeyBy attributes
+func (r *policyRule) key(attrs Attributes) string {
+	parts := make([]string, len(r.KeyBy))
+	for i, attr := range r.KeyBy {
+		switch attr {
+		case "tenant":
+			parts[i] = attrs.Tenant
+		case "plan":
+			parts[i] = attrs.Plan
+		case "route":
+			parts[i] = attrs.Route
+		case "method":
+			parts[i] = attrs.Method
+		default:
+			parts[i] = attrs.Labels[strings.TrimPrefix(attr, "label:")]
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
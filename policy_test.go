@@ -0,0 +1,229 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestPolicy(t *testing.T) {
+	perMinute := func(rate int) *ratelimiter.Config {
+		config := ratelimiter.DefaultConfig()
+		config.Algorithm = ratelimiter.FixedWindowAlgorithm
+		config.Rate = rate
+		config.Window = time.Minute
+		config.Clock = ratelimiter.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		return config
+	}
+
+	rules := []ratelimiter.Rule{
+		{Name: "internal", Match: ratelimiter.Match{Plan: "internal"}, Unlimited: true},
+		{Name: "free-search", Match: ratelimiter.Match{Plan: "free", Route: "/search"}, Config: perMinute(60)},
+		{Name: "paid", Match: ratelimiter.Match{Plan: "paid"}, Config: perMinute(600)},
+	}
+
+	// closeOnCleanup closes policy when the test ends
+	closeOnCleanup := func(t *testing.T, policy *ratelimiter.Policy) {
+		t.Cleanup(func() {
+			if err := policy.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		})
+	}
+
+	allowed := func(policy *ratelimiter.Policy, attrs ratelimiter.Attributes, n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if policy.Allow(attrs) {
+				count++
+			}
+		}
+		return count
+	}
+
+	t.Run("Plans", func(t *testing.T) {
+		policy, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, rules...)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, policy)
+
+		free := ratelimiter.Attributes{Tenant: "alice", Plan: "free", Route: "/search"}
+		if got := allowed(policy, free, 100); got != 60 {
+			t.Errorf("Expected 60 free searches, got %d", got)
+		}
+		paid := ratelimiter.Attributes{Tenant: "bob", Plan: "paid", Route: "/search"}
+		if got := allowed(policy, paid, 700); got != 600 {
+			t.Errorf("Expected 600 paid searches, got %d", got)
+		}
+		internal := ratelimiter.Attributes{Tenant: "billing", Plan: "internal", Route: "/search"}
+		if got := allowed(policy, internal, 1000); got != 1000 {
+			t.Errorf("Expected internal requests to be unlimited, got %d", got)
+		}
+		if policy.Limiter(internal) != nil {
+			t.Error("Expected no limiter for an unlimited rule")
+		}
+		if err := policy.Wait(context.Background(), internal); err != nil {
+			t.Errorf("Expected Wait to return at once for an unlimited rule, got %v", err)
+		}
+
+		other := ratelimiter.Attributes{Tenant: "alice", Plan: "free", Route: "/home"}
+		if got := allowed(policy, other, 100); got != 100 {
+			t.Errorf("Expected requests matching no rule to be unlimited, got %d", got)
+		}
+	})
+
+	t.Run("Per Key Limiters", func(t *testing.T) {
+		policy, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, rules...)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, policy)
+
+		alice := ratelimiter.Attributes{Tenant: "alice", Plan: "free", Route: "/search"}
+		carol := ratelimiter.Attributes{Tenant: "carol", Plan: "free", Route: "/search"}
+		allowed(policy, alice, 60)
+		if !policy.Allow(carol) {
+			t.Error("Each tenant should have its own limiter")
+		}
+
+		keyed, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, ratelimiter.Rule{
+			Name:   "per-region",
+			Config: perMinute(1),
+			KeyBy:  []string{"label:region", "method"},
+		})
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, keyed)
+
+		eu := ratelimiter.Attributes{Tenant: "a", Method: "GET", Labels: map[string]string{"region": "eu"}}
+		euOther := ratelimiter.Attributes{Tenant: "b", Method: "GET", Labels: map[string]string{"region": "eu"}}
+		us := ratelimiter.Attributes{Tenant: "a", Method: "GET", Labels: map[string]string{"region": "us"}}
+		if !keyed.Allow(eu) || keyed.Allow(euOther) || !keyed.Allow(us) {
+			t.Error("Expected limiters keyed by region and method only")
+		}
+	})
+
+	t.Run("Most Specific", func(t *testing.T) {
+		policy, err := ratelimiter.NewPolicy(ratelimiter.MostSpecific,
+			ratelimiter.Rule{Name: "default", Config: perMinute(10)},
+			ratelimiter.Rule{Name: "api", Match: ratelimiter.Match{Route: "/api/*"}, Config: perMinute(20)},
+			ratelimiter.Rule{Name: "api-post", Match: ratelimiter.Match{Route: "/api/*", Method: "POST"}, Config: perMinute(5)},
+			ratelimiter.Rule{Name: "api-get", Match: ratelimiter.Match{Route: "/api/*", Method: "GET"}, Config: perMinute(5)},
+			ratelimiter.Rule{Name: "beta", Match: ratelimiter.Match{Labels: map[string]string{"beta": "1", "canary": "1"}}, Config: perMinute(1)},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, policy)
+
+		tests := []struct {
+			attrs ratelimiter.Attributes
+			rule  string
+		}{
+			{ratelimiter.Attributes{Route: "/home"}, "default"},
+			{ratelimiter.Attributes{Route: "/api/users", Method: "DELETE"}, "api"},
+			{ratelimiter.Attributes{Route: "/api/users", Method: "post"}, "api-post"},
+			{ratelimiter.Attributes{Route: "/api/users", Labels: map[string]string{"beta": "1", "canary": "1"}}, "beta"},
+		}
+		for _, tt := range tests {
+			if got := policy.Evaluate(tt.attrs); got.Rule != tt.rule {
+				t.Errorf("%+v: expected rule %s, got %s", tt.attrs, tt.rule, got.Rule)
+			}
+		}
+
+		first, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch,
+			ratelimiter.Rule{Name: "default", Config: perMinute(10)},
+			ratelimiter.Rule{Name: "api", Match: ratelimiter.Match{Route: "/api/*"}, Config: perMinute(20)},
+		)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, first)
+		if got := first.Evaluate(ratelimiter.Attributes{Route: "/api/users"}); got.Rule != "default" {
+			t.Errorf("Expected the first matching rule, got %s", got.Rule)
+		}
+	})
+
+	t.Run("Evaluate", func(t *testing.T) {
+		policy, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, rules...)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, policy)
+
+		attrs := ratelimiter.Attributes{Tenant: "alice", Plan: "free", Route: "/search"}
+		for i := 0; i < 100; i++ {
+			got := policy.Evaluate(attrs)
+			if !got.Matched || got.Rule != "free-search" || got.Index != 1 || got.Key != "alice" || got.Unlimited {
+				t.Fatalf("Unexpected evaluation %+v", got)
+			}
+		}
+		if got := allowed(policy, attrs, 100); got != 60 {
+			t.Errorf("Evaluate should not count requests, got %d allowed", got)
+		}
+
+		if got := policy.Evaluate(ratelimiter.Attributes{Plan: "internal"}); !got.Matched || !got.Unlimited || got.Rule != "internal" {
+			t.Errorf("Unexpected evaluation %+v", got)
+		}
+		if got := policy.Evaluate(ratelimiter.Attributes{Plan: "trial"}); got.Matched || got.Index != -1 || !got.Unlimited {
+			t.Errorf("Unexpected evaluation %+v", got)
+		}
+	})
+
+	t.Run("Invalid Rules", func(t *testing.T) {
+		invalid := [][]ratelimiter.Rule{
+			{{Name: "no-config"}},
+			{{Name: "bad-config", Config: perMinute(0)}},
+			{{Name: "bad-route", Match: ratelimiter.Match{Route: "/api/["}, Unlimited: true}},
+			{{Name: "bad-key", Config: perMinute(1), KeyBy: []string{"user"}}},
+		}
+		for _, rules := range invalid {
+			if _, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, rules...); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+				t.Errorf("%s: expected ErrInvalidConfig, got %v", rules[0].Name, err)
+			}
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		data := `[
+			{"name": "internal", "match": {"plan": "internal"}, "unlimited": true},
+			{"name": "free-search", "match": {"plan": "free", "route": "/search"}, "config": "60/m algo=fixed_window"},
+			{"name": "paid", "match": {"plan": "paid"}, "config": {"algorithm": "sliding_window", "rate": 600, "window": "1m"}}
+		]`
+		var rules []ratelimiter.Rule
+		if err := json.Unmarshal([]byte(data), &rules); err != nil {
+			t.Fatalf("Failed to unmarshal rules: %v", err)
+		}
+		if rules[2].Config.Shards != ratelimiter.DefaultConfig().Shards {
+			t.Errorf("Expected rule configs on top of the defaults, got %+v", *rules[2].Config)
+		}
+
+		policy, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, rules...)
+		if err != nil {
+			t.Fatalf("Failed to create policy: %v", err)
+		}
+		closeOnCleanup(t, policy)
+		if got := allowed(policy, ratelimiter.Attributes{Tenant: "a", Plan: "free", Route: "/search"}, 100); got != 60 {
+			t.Errorf("Expected 60 free searches, got %d", got)
+		}
+	})
+
+	t.Run("JSON Without Config", func(t *testing.T) {
+		var rules []ratelimiter.Rule
+		if err := json.Unmarshal([]byte(`[{"name": "free", "match": {"plan": "free"}}]`), &rules); err != nil {
+			t.Fatalf("Failed to unmarshal rules: %v", err)
+		}
+		if rules[0].Config != nil {
+			t.Errorf("Expected no config, got %+v", *rules[0].Config)
+		}
+		if _, err := ratelimiter.NewPolicy(ratelimiter.FirstMatch, rules...); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig for a rule without a config, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,66 @@
+package ratelimiter
+
+import (
+	"slices"
+	"sync"
+)
+
+// Factory builds the limiter for an algorithm from a validated Config
+type Factory func(*Config) (Limiter, error)
+
+var registry = struct {
+	sync.RWMutex
+	factories map[Algorithm]Factory
+}{factories: make(map[Algorithm]Factory)}
+
+func init() {
+	RegisterAlgorithm(TokenBucketAlgorithm, func(c *Config) (Limiter, error) { return NewTokenBucket(c), nil })
+	RegisterAlgorithm(FixedWindowAlgorithm, func(c *Config) (Limiter, error) { return NewFixedWindow(c), nil })
+	RegisterAlgorithm(SlidingWindowAlgorithm, func(c *Config) (Limiter, error) { return NewSlidingWindow(c), nil })
+	RegisterAlgorithm(SlidingWindowCounterAlgorithm, func(c *Config) (Limiter, error) { return NewSlidingWindowCounter(c), nil })
+	RegisterAlgorithm(NestedWindowAlgorithm, func(c *Config) (Limiter, error) { return NewNestedWindow(c), nil })
+	RegisterAlgorithm(GCRAAlgorithm, func(c *Config) (Limiter, error) { return NewGCRA(c), nil })
+	RegisterAlgorithm(LeakyBucketAlgorithm, func(c *Config) (Limiter, error) { return NewLeakyBucket(c), nil })
+}
+
+// RegisterAlgorithm makes an algorithm available to New, NewKeyed and
+// NewConcurrency under the given name, so it can be selected with
+// WithAlgorithm and is wrapped with metrics like the built-in ones. It is
+// meant to be called from an init function and panics if the name is already
+// registered or the factory is nil.
+func RegisterAlgorithm(name Algorithm, factory Factory) {
+	if factory == nil {
+		panic("ratelimiter: RegisterAlgorithm factory is nil for " + string(name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if _, dup := registry.factories[name]; dup {
+		panic("ratelimiter: RegisterAlgorithm called twice for " + string(name))
+	}
+	registry.factories[name] = factory
+}
+
+// Algorithms returns the names of all registered algorithms, built-in and
+// custom, in sorted order
+func Algorithms() []Algorithm {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	names := make([]Algorithm, 0, len(registry.factories))
+	for name := range registry.factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// lookupAlgorithm returns the factory registered under name
+func lookupAlgorithm(name Algorithm) (Factory, bool) {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	factory, ok := registry.factories[name]
+	return factory, ok
+}
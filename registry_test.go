@@ -0,0 +1,133 @@
+package ratelimiter_test
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+const (
+	customAlgorithm  ratelimiter.Algorithm = "test_custom"
+	failingAlgorithm ratelimiter.Algorithm = "test_failing"
+	plainAlgorithm   ratelimiter.Algorithm = "test_plain"
+)
+
+var errFactory = errors.New("factory failed")
+
+// plainLimiter only has the methods of the Limiter interface, like limiters
+// written before the optional interfaces existed
+type plainLimiter struct {
+	ratelimiter.Limiter
+}
+
+func init() {
+	ratelimiter.RegisterAlgorithm(customAlgorithm, func(c *ratelimiter.Config) (ratelimiter.Limiter, error) {
+		return ratelimiter.NewFixedWindow(c), nil
+	})
+	ratelimiter.RegisterAlgorithm(failingAlgorithm, func(*ratelimiter.Config) (ratelimiter.Limiter, error) {
+		return nil, errFactory
+	})
+	ratelimiter.RegisterAlgorithm(plainAlgorithm, func(c *ratelimiter.Config) (ratelimiter.Limiter, error) {
+		return plainLimiter{ratelimiter.NewFixedWindow(c)}, nil
+	})
+}
+
+func TestRegisterAlgorithm(t *testing.T) {
+	t.Run("Select By Name", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(customAlgorithm),
+			ratelimiter.WithRate(1),
+			ratelimiter.WithWindow(time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		if _, ok := limiter.(*ratelimiter.FixedWindow); !ok {
+			t.Fatalf("Expected the limiter built by the factory, got %T", limiter)
+		}
+		if !limiter.Allow() || limiter.Allow() {
+			t.Error("Custom limiter should allow exactly one request")
+		}
+	})
+
+	t.Run("Metrics Wrapper", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(plainAlgorithm),
+			ratelimiter.WithMetrics(true),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		if _, ok := limiter.(*ratelimiter.MetricsWrapper); !ok {
+			t.Errorf("Expected a MetricsWrapper, got %T", limiter)
+		}
+	})
+
+	t.Run("Factory Error", func(t *testing.T) {
+		if _, err := ratelimiter.New(ratelimiter.WithAlgorithm(failingAlgorithm)); !errors.Is(err, errFactory) {
+			t.Errorf("Expected the factory error, got %v", err)
+		}
+		if _, err := ratelimiter.NewKeyedLimiter(ratelimiter.WithAlgorithm(failingAlgorithm)); !errors.Is(err, errFactory) {
+			t.Errorf("NewKeyedLimiter: expected the factory error, got %v", err)
+		}
+	})
+
+	t.Run("Common Validation", func(t *testing.T) {
+		_, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(customAlgorithm),
+			ratelimiter.WithRate(0),
+			ratelimiter.WithMaxWaiters(-1),
+		)
+		var configErr *ratelimiter.ConfigError
+		if !errors.As(err, &configErr) {
+			t.Fatalf("Expected a ConfigError, got %v", err)
+		}
+		if len(configErr.Fields) != 1 || configErr.Fields[0].Field != "MaxWaiters" {
+			t.Errorf("Expected only MaxWaiters to be invalid, got %v", err)
+		}
+	})
+
+	t.Run("Algorithms", func(t *testing.T) {
+		algorithms := ratelimiter.Algorithms()
+		for _, algo := range []ratelimiter.Algorithm{
+			ratelimiter.TokenBucketAlgorithm,
+			ratelimiter.FixedWindowAlgorithm,
+			ratelimiter.SlidingWindowAlgorithm,
+			ratelimiter.SlidingWindowCounterAlgorithm,
+			ratelimiter.NestedWindowAlgorithm,
+			ratelimiter.GCRAAlgorithm,
+			ratelimiter.LeakyBucketAlgorithm,
+			customAlgorithm,
+		} {
+			if !slices.Contains(algorithms, algo) {
+				t.Errorf("Expected %s to be registered, got %v", algo, algorithms)
+			}
+		}
+		if !slices.IsSorted(algorithms) {
+			t.Errorf("Expected algorithms in sorted order, got %v", algorithms)
+		}
+	})
+
+	t.Run("Duplicate Panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Registering a built-in name again should panic")
+			}
+		}()
+		ratelimiter.RegisterAlgorithm(ratelimiter.TokenBucketAlgorithm, func(c *ratelimiter.Config) (ratelimiter.Limiter, error) {
+			return ratelimiter.NewTokenBucket(c), nil
+		})
+	})
+
+	t.Run("Nil Factory Panics", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Error("Registering a nil factory should panic")
+			}
+		}()
+		ratelimiter.RegisterAlgorithm("test_nil", nil)
+	})
+}
@@ -0,0 +1,455 @@
+package ratelimiter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// DefaultPollInterval is how often a Reloader checks its file for changes
+const DefaultPollInterval = 5 * time.Second
+
+// ReloaderOption configures a Reloader
+type ReloaderOption func(*Reloader)
+
+// WithPollInterval sets how often the Reloader checks the modification time of
+// its file. Zero disables polling.
+func WithPollInterval(interval time.Duration) ReloaderOption {
+	return func(r *Reloader) {
+		r.interval = interval
+	}
+}
+
+// WithReloadSignal makes the Reloader reload its file whenever the process
+// receives one of the signals, typically syscall.SIGHUP
+func WithReloadSignal(signals ...os.Signal) ReloaderOption {
+	return func(r *Reloader) {
+		r.signals = append(r.signals, signals...)
+	}
+}
+
+// WithReloadErrorHandler sets the function called when a reload triggered by
+// polling or a signal fails. The last good configuration stays in effect.
+func WithReloadErrorHandler(handler func(error)) ReloaderOption {
+	return func(r *Reloader) {
+		r.onError = handler
+	}
+}
+
+// WithReloadClock sets the Clock used for polling and by the limiters the
+// Reloader builds
+func WithReloadClock(clock Clock) ReloaderOption {
+	return func(r *Reloader) {
+		r.clock = clock
+	}
+}
+
+// Reloader keeps a set of named limiters in line with a JSON file that maps
+// each name to a Config, written as an object or in the compact form read by
+// ParseConfig:
+//
+//	{"api": "100/m burst=20 algo=sliding_window", "login": {"rate": 5, "window": "1m", "algorithm": "fixed_window"}}
+//
+// Each entry is decoded on top of DefaultConfig. On reload, changes to Rate,
+// Burst, Capacity and Window are applied to the running limiter in place
+// through Tunable, keeping its state; any other change replaces the limiter
+// behind the name. Entries added to the file get a new limiter and removed
+// ones are dropped.
+// A file that fails to parse or validate is rejected as a whole and the last
+// good configuration stays in effect.
+type Reloader struct {
+	path     string
+	interval time.Duration
+	signals  []os.Signal
+	onError  func(error)
+	clock    Clock
+
+	reloading sync.Mutex // serializes reloads
+	mu        sync.RWMutex
+	configs   map[string]*Config
+	limiters  map[string]Limiter
+	handles   map[string]*reloadedLimiter
+	modTime   time.Time
+	size      int64
+
+	closed closer
+	wg     sync.WaitGroup
+}
+
+// NewReloader loads the file at path, builds its limiters and starts watching
+// the file. It returns an error if the file cannot be loaded.
+func NewReloader(path string, opts ...ReloaderOption) (*Reloader, error) {
+	r := &Reloader{
+		path:     path,
+		interval: DefaultPollInterval,
+		clock:    SystemClock(),
+		configs:  make(map[string]*Config),
+		limiters: make(map[string]Limiter),
+		handles:  make(map[string]*reloadedLimiter),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	if r.interval > 0 {
+		r.wg.Add(1)
+		go r.poll()
+	}
+	if len(r.signals) > 0 {
+		// Register before returning so that no signal sent afterwards is missed
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, r.signals...)
+		r.wg.Add(1)
+		go r.watchSignals(ch)
+	}
+	return r, nil
+}
+
+// Limiter returns the limiter for name, or nil if the file has no such entry.
+// The limiter can be kept across reloads: it forwards every call to the
+// limiter currently built for name, and callers blocked in its Wait when a
+// reload replaces that limiter go on waiting on the replacement. Once the
+// entry is removed from the file the limiter is closed for good and rejects
+// every call; an entry added back later gets a new limiter.
+func (r *Reloader) Limiter(name string) Limiter {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if handle, ok := r.handles[name]; ok {
+		return handle
+	}
+	return nil
+}
+
+// Config returns a copy of the configuration in effect for name, or nil if the
+// file has no such entry
+func (r *Reloader) Config(name string) *Config {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	config, ok := r.configs[name]
+	if !ok {
+		return nil
+	}
+	copied := *config
+	return &copied
+}
+
+// Reload reads the file now and applies it. On error the last good
+// configuration stays in effect.
+func (r *Reloader) Reload() error {
+	r.reloading.Lock()
+	defer r.reloading.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return fmt.Errorf("ratelimiter: reload %s: %w", r.path, err)
+	}
+	configs, err := r.load()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Remember a broken file too, so polling reports it once rather than on every tick
+	r.modTime, r.size = info.ModTime(), info.Size()
+	if err != nil {
+		return fmt.Errorf("ratelimiter: reload %s: %w", r.path, err)
+	}
+	return r.apply(configs)
+}
+
+// Close stops watching the file. The limiters keep working with the last
+// configuration loaded.
+func (r *Reloader) Close() error {
+	r.closed.close()
+	r.wg.Wait()
+	return nil
+}
+
+// load reads and validates every entry of the file
+func (r *Reloader) load() (map[string]*Config, error) {
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return nil, err
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+
+	configs := make(map[string]*Config, len(entries))
+	for name, entry := range entries {
+		config := DefaultConfig()
+		if err := json.Unmarshal(entry, config); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		config.Clock = r.clock
+		if err := config.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		configs[name] = config
+	}
+	return configs, nil
+}
+
+// apply brings the limiters in line with configs; the caller holds r.mu.
+// Replacement limiters are built before any limiter is retuned, so a failure
+// leaves everything as it was.
+func (r *Reloader) apply(configs map[string]*Config) error {
+	limiters := make(map[string]Limiter, len(configs))
+	for name, config := range configs {
+		if limiter, ok := r.limiters[name]; ok && retunable(limiter, r.configs[name], config) {
+			continue
+		}
+		limiter, err := New(WithConfig(config))
+		if err != nil {
+			for _, limiter := range limiters {
+				// Nobody has seen these limiters yet; only the build error matters
+				_ = closeLimiter(limiter)
+			}
+			return fmt.Errorf("ratelimiter: reload %s: %s: %w", r.path, name, err)
+		}
+		limiters[name] = limiter
+	}
+
+	for name, config := range configs {
+		if _, ok := limiters[name]; !ok {
+			limiter := r.limiters[name]
+			retune(limiter, r.configs[name], config)
+			limiters[name] = limiter
+		}
+	}
+	handles := make(map[string]*reloadedLimiter, len(limiters))
+	for name, limiter := range limiters {
+		handle, ok := r.handles[name]
+		if !ok {
+			handle = &reloadedLimiter{}
+		}
+		handle.store(limiter)
+		handles[name] = handle
+	}
+	superseded := r.limiters
+	r.configs = configs
+	r.limiters = limiters
+	r.handles = handles
+
+	// Wake callers blocked on the old limiters, now that their handles point
+	// at the new ones. The new configuration is in effect either way, so a
+	// limiter that fails to close does not fail the reload.
+	for name, limiter := range superseded {
+		if limiters[name] != limiter {
+			_ = closeLimiter(limiter)
+		}
+	}
+	return nil
+}
+
+// retunable reports whether the change from old to config can be applied to
+// the limiter in place. The metrics wrapper is Tunable whatever it wraps, so
+// it is the wrapped limiter that has to be.
+func retunable(limiter Limiter, old, config *Config) bool {
+	switch wrapper := limiter.(type) {
+	case *MetricsWrapper:
+		limiter = wrapper.limiter
+	case *reservingMetricsWrapper:
+		limiter = wrapper.limiter
+	}
+	if _, ok := limiter.(Tunable); !ok {
+		return *old == *config
+	}
+
+	// Everything except the limits Tunable can change must stay the same. A
+	// Nested Window scales its inner window with SetWindow, which only matches
+	// the new config if the inner window is derived from the window.
+	rest := *old
+	rest.Rate, rest.Burst, rest.Capacity, rest.Window = config.Rate, config.Burst, config.Capacity, config.Window
+	return rest == *config && (config.InnerWindow == 0 || old.Window == config.Window)
+}
+
+// retune applies the change from old to config to a retunable limiter
+func retune(limiter Limiter, old, config *Config) {
+	tunable, ok := limiter.(Tunable)
+	if !ok {
+		return
+	}
+	if old.Rate != config.Rate {
+		tunable.SetRate(config.Rate)
+	}
+	if old.Burst != config.Burst {
+		tunable.SetBurst(config.Burst)
+	}
+	if old.Capacity != config.Capacity {
+		tunable.SetCapacity(config.Capacity)
+	}
+	if old.Window != config.Window {
+		tunable.SetWindow(config.Window)
+	}
+}
+
+// poll reloads the file whenever its modification time or size changes
+func (r *Reloader) poll() {
+	defer r.wg.Done()
+
+	timer := r.clock.NewTimer(r.interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C():
+		case <-r.closed.done():
+			return
+		}
+
+		if r.changed() {
+			r.reload()
+		}
+		timer.Reset(r.interval)
+	}
+}
+
+// changed reports whether the file differs from the one last loaded
+func (r *Reloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		r.report(fmt.Errorf("ratelimiter: reload %s: %w", r.path, err))
+		return false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return !info.ModTime().Equal(r.modTime) || info.Size() != r.size
+}
+
+// watchSignals reloads the file whenever a signal arrives on ch
+func (r *Reloader) watchSignals(ch chan os.Signal) {
+	defer r.wg.Done()
+	defer signal.Stop(ch)
+
+	for {
+		select {
+		case <-ch:
+			r.reload()
+		case <-r.closed.done():
+			return
+		}
+	}
+}
+
+// reload reloads the file in the background, reporting any error
+func (r *Reloader) reload() {
+	if err := r.Reload(); err != nil {
+		r.report(err)
+	}
+}
+
+func (r *Reloader) report(err error) {
+	if r.onError != nil {
+		r.onError(err)
+	}
+}
+
+// reloadedLimiter is the Limiter a Reloader hands out for a name. It forwards
+// to the limiter currently built for the name, which a reload may replace.
+// Requests denied by a limiter that was replaced meanwhile, and waits it cut
+// short by closing, are retried on the new one.
+type reloadedLimiter struct {
+	mu      sync.RWMutex
+	current Limiter
+}
+
+func (rl *reloadedLimiter) load() Limiter {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return rl.current
+}
+
+func (rl *reloadedLimiter) store(limiter Limiter) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+	rl.current = limiter
+}
+
+// replaced reports whether a reload has replaced limiter
+func (rl *reloadedLimiter) replaced(limiter Limiter) bool {
+	return rl.load() != limiter
+}
+
+func (rl *reloadedLimiter) Allow() bool {
+	return rl.AllowN(1)
+}
+
+func (rl *reloadedLimiter) AllowN(n int) bool {
+	for {
+		limiter := rl.load()
+		if allowed := limiter.AllowN(n); allowed || !rl.replaced(limiter) {
+			return allowed
+		}
+	}
+}
+
+func (rl *reloadedLimiter) Wait(ctx context.Context) error {
+	return rl.WaitN(ctx, 1)
+}
+
+// WaitN waits on the current limiter, and on its replacement if a reload
+// replaces it in the meantime
+func (rl *reloadedLimiter) WaitN(ctx context.Context, n int) error {
+	for {
+		limiter := rl.load()
+		err := limiter.WaitN(ctx, n)
+		if !errors.Is(err, ErrLimiterClosed) || !rl.replaced(limiter) {
+			return err
+		}
+	}
+}
+
+func (rl *reloadedLimiter) Admit() error {
+	return rl.AdmitN(1)
+}
+
+// AdmitN admits N requests on the current limiter. If it is not an Admitter,
+// denials are reported as a RateLimitError without details.
+func (rl *reloadedLimiter) AdmitN(n int) error {
+	for {
+		limiter := rl.load()
+		var err error
+		if admitter, ok := limiter.(Admitter); ok {
+			err = admitter.AdmitN(n)
+		} else if !limiter.AllowN(n) {
+			err = &RateLimitError{RetryAfter: InfDuration}
+		}
+		if err == nil || !rl.replaced(limiter) {
+			return err
+		}
+	}
+}
+
+// AllowDecision admits N requests on the current limiter. If it is not an
+// Admitter, the decision only says whether they were allowed.
+func (rl *reloadedLimiter) AllowDecision(n int) Decision {
+	for {
+		limiter := rl.load()
+		var d Decision
+		if admitter, ok := limiter.(Admitter); ok {
+			d = admitter.AllowDecision(n)
+		} else if d.Allowed = limiter.AllowN(n); !d.Allowed {
+			d.RetryAfter = InfDuration
+		}
+		if d.Allowed || !rl.replaced(limiter) {
+			return d
+		}
+	}
+}
+
+func (rl *reloadedLimiter) Reset() {
+	rl.load().Reset()
+}
+
+func (rl *reloadedLimiter) GetMetrics() Metrics {
+	return rl.load().GetMetrics()
+}
@@ -0,0 +1,252 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestReloader(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// write replaces the file and moves its modification time forward, so
+	// polling sees the change even on filesystems with coarse timestamps
+	write := func(t *testing.T, path, data string) {
+		t.Helper()
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime().Add(time.Second)
+		} else {
+			modTime = time.Now()
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+
+	newReloader := func(t *testing.T, data string, opts ...ratelimiter.ReloaderOption) (*ratelimiter.Reloader, string) {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "limits.json")
+		write(t, path, data)
+		reloader, err := ratelimiter.NewReloader(path, opts...)
+		if err != nil {
+			t.Fatalf("Failed to create reloader: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := reloader.Close(); err != nil {
+				t.Errorf("Close failed: %v", err)
+			}
+		})
+		return reloader, path
+	}
+
+	// eventually waits for a reload running in the background
+	eventually := func(t *testing.T, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatal("Condition not met in time")
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	t.Run("Load", func(t *testing.T) {
+		reloader, _ := newReloader(t, `{
+			"api": "100/m burst=20 algo=sliding_window",
+			"login": {"algorithm": "fixed_window", "rate": 5, "window": "1m"}
+		}`, ratelimiter.WithPollInterval(0))
+
+		if reloader.Limiter("api") == nil || reloader.Limiter("login") == nil {
+			t.Fatal("Expected a limiter for every entry")
+		}
+		if reloader.Limiter("missing") != nil || reloader.Config("missing") != nil {
+			t.Error("Expected nothing for an unknown name")
+		}
+		config := reloader.Config("login")
+		if config.Rate != 5 || config.Window != time.Minute || config.Shards != ratelimiter.DefaultConfig().Shards {
+			t.Errorf("Expected the entry on top of the defaults, got %+v", *config)
+		}
+	})
+
+	t.Run("Retune In Place", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		reloader, path := newReloader(t, `{"api": "2/m algo=fixed_window"}`,
+			ratelimiter.WithPollInterval(0), ratelimiter.WithReloadClock(clock))
+
+		limiter := reloader.Limiter("api")
+		limiter.Allow()
+		limiter.Allow()
+
+		write(t, path, `{"api": "3/m algo=fixed_window"}`)
+		if err := reloader.Reload(); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+		if reloader.Limiter("api") != limiter {
+			t.Fatal("Expected the limiter to be retuned in place")
+		}
+		if !limiter.Allow() || limiter.Allow() {
+			t.Error("Expected one more request in the current window after raising the rate")
+		}
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		reloader, path := newReloader(t, `{"api": "2/m algo=fixed_window", "old": "1/s"}`,
+			ratelimiter.WithPollInterval(0))
+		limiter := reloader.Limiter("api")
+		removed := reloader.Limiter("old")
+
+		limiter.AllowN(2)
+		waited := make(chan error, 1)
+		go func() { waited <- limiter.Wait(context.Background()) }()
+		eventually(t, func() bool { return limiter.GetMetrics().QueueDepth == 1 })
+
+		write(t, path, `{"api": "2/m algo=sliding_window", "new": "1/s"}`)
+		if err := reloader.Reload(); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+		if reloader.Limiter("api") != limiter {
+			t.Error("Expected the limiter handed out to follow the replacement")
+		}
+		if reloader.Limiter("old") != nil || reloader.Limiter("new") == nil {
+			t.Error("Expected removed entries to be dropped and added ones built")
+		}
+
+		select {
+		case err := <-waited:
+			if err != nil {
+				t.Errorf("Expected a caller blocked on the replaced limiter to be admitted by the new one, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Error("Expected a caller blocked on the replaced limiter to move to the new one")
+		}
+		if !limiter.Allow() || limiter.Allow() {
+			t.Error("Expected the new limiter to allow one more request after the moved caller")
+		}
+		if err := removed.Wait(context.Background()); !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+			t.Errorf("Expected the removed limiter to be closed, got %v", err)
+		}
+		if removed.Allow() {
+			t.Error("Expected the removed limiter to reject every request")
+		}
+	})
+
+	t.Run("Replace Limiter That Cannot Be Retuned", func(t *testing.T) {
+		reloader, path := newReloader(t, `{"api": {"algorithm": "test_plain", "rate": 2, "window": "1m", "metrics": true}}`,
+			ratelimiter.WithPollInterval(0))
+		reloader.Limiter("api").AllowN(2)
+
+		write(t, path, `{"api": {"algorithm": "test_plain", "rate": 3, "window": "1m", "metrics": true}}`)
+		if err := reloader.Reload(); err != nil {
+			t.Fatalf("Failed to reload: %v", err)
+		}
+		limiter := reloader.Limiter("api")
+		for i := 0; i < 3; i++ {
+			if !limiter.Allow() {
+				t.Fatalf("Request %d should be allowed by a limiter built with the new rate", i+1)
+			}
+		}
+	})
+
+	t.Run("Keep Last Good Config", func(t *testing.T) {
+		reloader, path := newReloader(t, `{"api": "2/m algo=fixed_window"}`,
+			ratelimiter.WithPollInterval(0))
+		limiter := reloader.Limiter("api")
+
+		for _, data := range []string{
+			`{"api": "2/m algo=fixed_window"`,
+			`{"api": "0/m algo=fixed_window", "other": "1/s"}`,
+		} {
+			write(t, path, data)
+			if err := reloader.Reload(); err == nil {
+				t.Errorf("Expected an error reloading %s", data)
+			}
+			if reloader.Limiter("api") != limiter || reloader.Limiter("other") != nil {
+				t.Errorf("Expected the last good config to stay in effect after %s", data)
+			}
+		}
+
+		write(t, path, `{"api": "0/m algo=fixed_window"}`)
+		if err := reloader.Reload(); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+			t.Errorf("Expected ErrInvalidConfig, got %v", err)
+		}
+		if config := reloader.Config("api"); config.Rate != 2 {
+			t.Errorf("Expected rate 2 to stay in effect, got %d", config.Rate)
+		}
+		if !limiter.Allow() {
+			t.Error("Expected the limiter to keep working after a rejected reload")
+		}
+	})
+
+	t.Run("Poll", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(start)
+		errs := make(chan error, 1)
+		reloader, path := newReloader(t, `{"api": "2/m algo=fixed_window"}`,
+			ratelimiter.WithPollInterval(time.Second),
+			ratelimiter.WithReloadClock(clock),
+			ratelimiter.WithReloadErrorHandler(func(err error) { errs <- err }))
+
+		write(t, path, `{"api": "5/m algo=fixed_window"}`)
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		eventually(t, func() bool { return reloader.Config("api").Rate == 5 })
+
+		write(t, path, `{"api": "-1/m algo=fixed_window"}`)
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		select {
+		case err := <-errs:
+			if !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+				t.Errorf("Expected ErrInvalidConfig, got %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Expected the error handler to be called")
+		}
+		if config := reloader.Config("api"); config.Rate != 5 {
+			t.Errorf("Expected rate 5 to stay in effect, got %d", config.Rate)
+		}
+
+		// An unchanged file is not reloaded again, so the error is reported once
+		clock.BlockUntil(1)
+		clock.Advance(time.Second)
+		clock.BlockUntil(1)
+		select {
+		case err := <-errs:
+			t.Errorf("Expected no error for an unchanged file, got %v", err)
+		default:
+		}
+	})
+
+	t.Run("Signal", func(t *testing.T) {
+		reloader, path := newReloader(t, `{"api": "2/m algo=fixed_window"}`,
+			ratelimiter.WithPollInterval(0),
+			ratelimiter.WithReloadSignal(syscall.SIGHUP))
+
+		write(t, path, `{"api": "7/m algo=fixed_window"}`)
+		process, err := os.FindProcess(os.Getpid())
+		if err != nil {
+			t.Fatalf("Failed to find process: %v", err)
+		}
+		if err := process.Signal(syscall.SIGHUP); err != nil {
+			t.Skipf("Cannot send SIGHUP on this platform: %v", err)
+		}
+		eventually(t, func() bool { return reloader.Config("api").Rate == 7 })
+	})
+
+	t.Run("Missing File", func(t *testing.T) {
+		_, err := ratelimiter.NewReloader(filepath.Join(t.TempDir(), "missing.json"))
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("Expected os.ErrNotExist, got %v", err)
+		}
+	})
+}
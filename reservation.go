@@ -0,0 +1,117 @@
+package ratelimiter
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// InfDuration is the delay reported by a Reservation that can never be satisfied
+const InfDuration = time.Duration(math.MaxInt64)
+
+// Reserver is implemented by limiters that can reserve capacity ahead of time
+type Reserver interface {
+	// Reserve reserves a single request
+	Reserve() *Reservation
+
+	// ReserveN reserves N requests
+	ReserveN(n int) *Reservation
+}
+
+// Reservation holds capacity taken from a limiter for a request that may act
+// now or at a later time. The caller either waits Delay() before acting or
+// calls Cancel to hand the capacity back. When the true cost is only known
+// afterwards, Reconcile settles the reservation against it.
+type Reservation struct {
+	ok        bool
+	tokens    int
+	timeToAct time.Time
+	adjust    func(tokens int) // takes more capacity from the issuing limiter, or gives it back when negative
+	refund    func(tokens int) // gives capacity back on Cancel; adjust is used when nil
+	clock     Clock
+	mu        sync.Mutex
+	canceled  bool
+}
+
+func newReservation(clock Clock, tokens int, timeToAct time.Time, adjust func(tokens int)) *Reservation {
+	return &Reservation{
+		ok:        true,
+		tokens:    tokens,
+		timeToAct: timeToAct,
+		adjust:    adjust,
+		clock:     clock,
+	}
+}
+
+// OK reports whether the limiter can ever satisfy the reservation.
+// A reservation that is not OK holds no capacity.
+func (r *Reservation) OK() bool {
+	return r.ok
+}
+
+// Delay returns how long to wait before acting on the reservation
+func (r *Reservation) Delay() time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	return r.DelayFrom(r.clock.Now())
+}
+
+// DelayFrom returns how long to wait from t before acting on the reservation.
+// It returns InfDuration if the reservation is not OK.
+func (r *Reservation) DelayFrom(t time.Time) time.Duration {
+	if !r.ok {
+		return InfDuration
+	}
+	delay := r.timeToAct.Sub(t)
+	if delay < 0 {
+		return 0
+	}
+	return delay
+}
+
+// Cancel gives the reserved capacity back to the limiter. Capacity that
+// belonged to a window that has already ended is not restored, and a Token
+// Bucket restores nothing once the time to act has passed, nor the tokens
+// that reservations made after this one were promised. Calling Cancel more
+// than once has no further effect.
+func (r *Reservation) Cancel() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ok || r.canceled {
+		return
+	}
+	r.canceled = true
+	if r.refund != nil {
+		r.refund(r.tokens)
+		return
+	}
+	r.adjust(-r.tokens)
+}
+
+// Tokens returns the number of tokens the reservation currently holds
+func (r *Reservation) Tokens() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.tokens
+}
+
+// Reconcile settles the reservation against the actual cost. If actual is
+// below the reserved amount the difference is refunded; if it is above, the
+// extra is charged even when that puts the limiter into debt, which delays
+// later requests until it is paid off. Reconcile may be called more than once;
+// each call settles against the amount currently held. It has no effect on a
+// reservation that is not OK or was canceled.
+func (r *Reservation) Reconcile(actual int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ok || r.canceled || actual < 0 {
+		return
+	}
+	if delta := actual - r.tokens; delta != 0 {
+		r.adjust(delta)
+		r.tokens = actual
+	}
+}
@@ -0,0 +1,280 @@
+package ratelimiter_test
+
+import (
+	"github.com/popeskul/ratelimiter"
+	"testing"
+	"time"
+)
+
+func TestReservation(t *testing.T) {
+	limiters := map[string]func() ratelimiter.Reserver{
+		"TokenBucket": func() ratelimiter.Reserver {
+			// A reservation that has acted cannot be canceled, so the clock must stand still
+			return ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 10, Capacity: 2, Clock: ratelimiter.NewFakeClock(time.Now())})
+		},
+		"FixedWindow": func() ratelimiter.Reserver {
+			return ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 2, Window: time.Second})
+		},
+		"SlidingWindow": func() ratelimiter.Reserver {
+			return ratelimiter.NewSlidingWindow(&ratelimiter.Config{Rate: 2, Window: time.Second})
+		},
+		"NestedWindow": func() ratelimiter.Reserver {
+			return ratelimiter.NewNestedWindow(&ratelimiter.Config{Rate: 10, Burst: 2, Window: 10 * time.Second})
+		},
+	}
+
+	for name, newLimiter := range limiters {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Immediate", func(t *testing.T) {
+				limiter := newLimiter()
+
+				r := limiter.ReserveN(2)
+				if !r.OK() {
+					t.Fatal("ReserveN(2) should be OK")
+				}
+				if d := r.Delay(); d != 0 {
+					t.Errorf("Expected no delay, got %v", d)
+				}
+			})
+
+			t.Run("Delayed", func(t *testing.T) {
+				limiter := newLimiter()
+
+				limiter.ReserveN(2)
+				r := limiter.Reserve()
+				if !r.OK() {
+					t.Fatal("Reserve should be OK")
+				}
+				if d := r.Delay(); d <= 0 || d > time.Second+time.Millisecond {
+					t.Errorf("Expected a delay of at most 1s, got %v", d)
+				}
+				if r.DelayFrom(time.Now().Add(2*time.Second)) != 0 {
+					t.Error("Expected no delay from a time after the reservation")
+				}
+			})
+
+			t.Run("Cancel", func(t *testing.T) {
+				limiter := newLimiter()
+
+				r := limiter.ReserveN(2)
+				if l, ok := limiter.(ratelimiter.Limiter); ok && l.Allow() {
+					t.Fatal("Allow should be denied while capacity is reserved")
+				}
+
+				r.Cancel()
+				r.Cancel() // a second cancel must not restore capacity twice
+
+				if d := limiter.ReserveN(2).Delay(); d != 0 {
+					t.Errorf("Expected no delay after cancel, got %v", d)
+				}
+				if d := limiter.Reserve().Delay(); d == 0 {
+					t.Error("Expected a delay once capacity is reserved again")
+				}
+			})
+
+			t.Run("Reconcile", func(t *testing.T) {
+				limiter := newLimiter()
+				metrics := limiter.(ratelimiter.Limiter).GetMetrics
+
+				r := limiter.ReserveN(2)
+				r.Reconcile(1)
+				if r.Tokens() != 1 {
+					t.Errorf("Expected the reservation to hold 1 token, got %d", r.Tokens())
+				}
+				if remaining := metrics().Remaining; remaining != 1 {
+					t.Errorf("Expected 1 remaining after a refund, got %d", remaining)
+				}
+
+				r.Reconcile(4)
+				if remaining := metrics().Remaining; remaining > 0 {
+					t.Errorf("Expected no remaining capacity after an extra charge, got %d", remaining)
+				}
+				if d := limiter.Reserve().Delay(); d == 0 {
+					t.Error("Expected a delay while the limiter is in debt")
+				}
+			})
+
+			t.Run("Never", func(t *testing.T) {
+				limiter := newLimiter()
+
+				r := limiter.ReserveN(100)
+				if r.OK() {
+					t.Error("ReserveN beyond the limit should not be OK")
+				}
+				if r.Delay() != ratelimiter.InfDuration {
+					t.Errorf("Expected InfDuration, got %v", r.Delay())
+				}
+				r.Cancel()
+
+				if d := limiter.ReserveN(2).Delay(); d != 0 {
+					t.Errorf("A failed reservation should not consume capacity, got delay %v", d)
+				}
+			})
+		})
+	}
+
+	t.Run("FixedWindow Future Window", func(t *testing.T) {
+		limiter := ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 2, Window: 100 * time.Millisecond})
+
+		limiter.ReserveN(2)
+		second := limiter.ReserveN(2)
+		third := limiter.ReserveN(2)
+
+		if d := second.Delay(); d <= 0 || d > 100*time.Millisecond {
+			t.Errorf("Expected the second reservation in the next window, got %v", d)
+		}
+		if d := third.Delay(); d <= 100*time.Millisecond || d > 200*time.Millisecond {
+			t.Errorf("Expected the third reservation two windows ahead, got %v", d)
+		}
+
+		time.Sleep(second.Delay())
+		if limiter.Allow() {
+			t.Error("Allow should be denied in a window that is fully reserved")
+		}
+	})
+
+	t.Run("FixedWindow Debt", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiter := ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 2, Window: time.Second, Clock: clock})
+
+		r := limiter.Reserve()
+		later := limiter.ReserveN(2)
+		if d := later.Delay(); d != time.Second {
+			t.Fatalf("Expected the second reservation in the next window, got %v", d)
+		}
+
+		// 9 in all: the first window holds 2, the debt fills the next three
+		// windows, taking in the second reservation, and the fifth holds the 1
+		// left over
+		r.Reconcile(7)
+		if d := limiter.Reserve().Delay(); d != 4*time.Second {
+			t.Errorf("Expected the debt to be paid off in the fifth window, got %v", d)
+		}
+		clock.Advance(4 * time.Second)
+		if limiter.Allow() {
+			t.Error("Allow should be denied once the fifth window is used up")
+		}
+		clock.Advance(time.Second)
+		if !limiter.AllowN(2) {
+			t.Error("AllowN(2) should be allowed once the debt is paid off")
+		}
+	})
+
+	t.Run("Large Debt", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+		limiters := map[string]ratelimiter.Reserver{
+			"FixedWindow": ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 1, Window: time.Second, Clock: clock}),
+			"NestedWindow": ratelimiter.NewNestedWindow(&ratelimiter.Config{
+				Rate: 100, Burst: 1, Window: 100 * time.Second, Clock: clock,
+			}),
+		}
+		for name, limiter := range limiters {
+			start := time.Now()
+			limiter.Reserve().Reconcile(2_000_000)
+			if d := limiter.Reserve().Delay(); d < 2_000_000*time.Second {
+				t.Errorf("%s: expected the debt to delay the next reservation, got %v", name, d)
+			}
+			if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+				t.Errorf("%s: expected a large debt to be recorded quickly, took %v", name, elapsed)
+			}
+		}
+	})
+
+	t.Run("TokenBucket Debt", func(t *testing.T) {
+		limiter := ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 10, Capacity: 2, Clock: ratelimiter.NewFakeClock(time.Now())})
+
+		r := limiter.ReserveN(2)
+		r.Reconcile(5)
+
+		if remaining := limiter.GetMetrics().Remaining; remaining != -3 {
+			t.Errorf("Expected a debt of 3 tokens, got %d remaining", remaining)
+		}
+		if d := limiter.Reserve().Delay(); d < 390*time.Millisecond || d > 400*time.Millisecond {
+			t.Errorf("Expected a delay of about 400ms to pay off the debt, got %v", d)
+		}
+
+		r.Cancel()
+		r.Reconcile(1) // no effect once canceled
+		// The 4 tokens promised to the later reservation are not given back
+		if remaining := limiter.GetMetrics().Remaining; remaining != -3 {
+			t.Errorf("Expected -3 remaining after canceling, got %d", remaining)
+		}
+	})
+
+	t.Run("TokenBucket Cancel", func(t *testing.T) {
+		newBucket := func() (*ratelimiter.TokenBucket, *ratelimiter.FakeClock) {
+			clock := ratelimiter.NewFakeClock(time.Now())
+			return ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 10, Capacity: 2, Clock: clock}), clock
+		}
+
+		t.Run("Before Acting", func(t *testing.T) {
+			limiter, clock := newBucket()
+			limiter.ReserveN(2)
+			r := limiter.ReserveN(2)
+			clock.Advance(100 * time.Millisecond)
+
+			r.Cancel()
+			if remaining := limiter.GetMetrics().Remaining; remaining != 1 {
+				t.Errorf("Expected the 2 tokens back, got %d remaining", remaining)
+			}
+		})
+
+		t.Run("After Acting", func(t *testing.T) {
+			limiter, clock := newBucket()
+			r := limiter.ReserveN(2)
+			clock.Advance(time.Millisecond)
+
+			r.Cancel()
+			if d := limiter.Reserve().Delay(); d == 0 {
+				t.Error("Canceling a reservation that has acted should not give its tokens back")
+			}
+		})
+
+		t.Run("Later Reservations", func(t *testing.T) {
+			limiter, _ := newBucket()
+			limiter.ReserveN(2)
+			r := limiter.ReserveN(2)   // acts after 200ms
+			later := limiter.Reserve() // acts after 300ms, relying on r going first
+
+			r.Cancel()
+			if remaining := limiter.GetMetrics().Remaining; remaining != -2 {
+				t.Errorf("Expected only the token not promised to the later reservation back, got %d remaining", remaining)
+			}
+			if d := limiter.Reserve().Delay(); d < later.Delay() {
+				t.Errorf("A new reservation should not act before the later one at %v, got %v", later.Delay(), d)
+			}
+		})
+	})
+
+	t.Run("MetricsWrapper", func(t *testing.T) {
+		limiter, _ := ratelimiter.New(
+			ratelimiter.WithAlgorithm("token_bucket"),
+			ratelimiter.WithRate(10),
+			ratelimiter.WithCapacity(1),
+			ratelimiter.WithMetrics(true),
+		)
+
+		reserver, ok := limiter.(ratelimiter.Reserver)
+		if !ok {
+			t.Fatal("MetricsWrapper should implement Reserver")
+		}
+		if !reserver.Reserve().OK() {
+			t.Error("Reserve should be OK")
+		}
+		if reserver.ReserveN(2).OK() {
+			t.Error("ReserveN beyond capacity should not be OK")
+		}
+
+		metrics := limiter.GetMetrics()
+		if metrics.AllowedRequests != 1 || metrics.DeniedRequests != 1 {
+			t.Errorf("Expected 1 allowed and 1 denied, got %d and %d", metrics.AllowedRequests, metrics.DeniedRequests)
+		}
+		counter, _ := ratelimiter.New(
+			ratelimiter.WithAlgorithm("sliding_window_counter"),
+			ratelimiter.WithMetrics(true),
+		)
+		if _, ok := counter.(ratelimiter.Reserver); ok {
+			t.Error("MetricsWrapper should not implement Reserver for a limiter that does not")
+		}
+	})
+}
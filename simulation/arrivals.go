@@ -0,0 +1,107 @@
+package simulation
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// never is the gap returned by processes that will not produce another arrival
+const never = time.Duration(math.MaxInt64)
+
+// Arrivals generates the times at which requests arrive
+type Arrivals interface {
+	// Next returns the time from an arrival at elapsed to the next arrival.
+	// A gap that is not positive ends the arrivals.
+	Next(elapsed time.Duration, rng *rand.Rand) time.Duration
+}
+
+// ArrivalsFunc adapts a function to the Arrivals interface
+type ArrivalsFunc func(elapsed time.Duration, rng *rand.Rand) time.Duration
+
+func (f ArrivalsFunc) Next(elapsed time.Duration, rng *rand.Rand) time.Duration {
+	return f(elapsed, rng)
+}
+
+// Constant produces perSecond evenly spaced arrivals per second
+func Constant(perSecond float64) Arrivals {
+	return ArrivalsFunc(func(time.Duration, *rand.Rand) time.Duration {
+		if perSecond <= 0 {
+			return never
+		}
+		return time.Duration(float64(time.Second) / perSecond)
+	})
+}
+
+// Poisson produces arrivals at an average of perSecond per second with
+// exponentially distributed gaps
+func Poisson(perSecond float64) Arrivals {
+	return ArrivalsFunc(func(_ time.Duration, rng *rand.Rand) time.Duration {
+		return exponential(perSecond, rng)
+	})
+}
+
+// Bursty alternates between on periods, with Poisson arrivals at perSecond,
+// and off periods without any arrivals
+func Bursty(perSecond float64, on, off time.Duration) Arrivals {
+	return ArrivalsFunc(func(elapsed time.Duration, rng *rand.Rand) time.Duration {
+		if on <= 0 {
+			return never
+		}
+		gap := exponential(perSecond, rng)
+		if gap == never {
+			return never
+		}
+
+		// The gap only runs down while the burst is on, so push it past every off period it spans
+		period := on + off
+		t := elapsed
+		for {
+			phase := t % period
+			if phase >= on {
+				t += period - phase
+				continue
+			}
+			if left := on - phase; gap >= left {
+				gap -= left
+				t += left
+				continue
+			}
+			return t + gap - elapsed
+		}
+	})
+}
+
+// Diurnal produces Poisson arrivals whose rate follows a sine wave around
+// mean per second, swinging by amplitude (0 to 1) of the mean over each period.
+// It starts at the mean and reaches its peak a quarter period in.
+func Diurnal(mean, amplitude float64, period time.Duration) Arrivals {
+	amplitude = math.Max(0, math.Min(amplitude, 1))
+	peak := mean * (1 + amplitude)
+	return ArrivalsFunc(func(elapsed time.Duration, rng *rand.Rand) time.Duration {
+		// Thinning: draw from the peak rate and keep each arrival with probability rate(t)/peak
+		t := elapsed
+		for {
+			gap := exponential(peak, rng)
+			if gap == never {
+				return never
+			}
+			t += gap
+			rate := mean
+			if period > 0 {
+				rate *= 1 + amplitude*math.Sin(2*math.Pi*float64(t)/float64(period))
+			}
+			if rng.Float64()*peak < rate {
+				return t - elapsed
+			}
+		}
+	})
+}
+
+// exponential draws the gap to the next event of a Poisson process with the given rate
+func exponential(perSecond float64, rng *rand.Rand) time.Duration {
+	if perSecond <= 0 {
+		return never
+	}
+	return max(time.Duration(rng.ExpFloat64()/perSecond*float64(time.Second)), 1)
+}
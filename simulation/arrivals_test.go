@@ -0,0 +1,78 @@
+package simulation_test
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter/simulation"
+)
+
+// arrivalTimes collects the arrival offsets a process produces within duration
+func arrivalTimes(arrivals simulation.Arrivals, duration time.Duration) []time.Duration {
+	rng := rand.New(rand.NewPCG(1, 1))
+	var times []time.Duration
+	for t := arrivals.Next(0, rng); t > 0 && t < duration; t += arrivals.Next(t, rng) {
+		times = append(times, t)
+	}
+	return times
+}
+
+func TestArrivals(t *testing.T) {
+	t.Run("Constant", func(t *testing.T) {
+		times := arrivalTimes(simulation.Constant(4), 2*time.Second)
+		if len(times) != 7 {
+			t.Fatalf("Expected 7 arrivals, got %d", len(times))
+		}
+		for i, at := range times {
+			if want := time.Duration(i+1) * 250 * time.Millisecond; at != want {
+				t.Errorf("Arrival %d: expected %v, got %v", i, want, at)
+			}
+		}
+	})
+
+	t.Run("Poisson", func(t *testing.T) {
+		times := arrivalTimes(simulation.Poisson(100), 100*time.Second)
+		if n := len(times); n < 9500 || n > 10500 {
+			t.Errorf("Expected about 10000 arrivals, got %d", n)
+		}
+	})
+
+	t.Run("Bursty", func(t *testing.T) {
+		times := arrivalTimes(simulation.Bursty(100, time.Second, 4*time.Second), 50*time.Second)
+		for _, at := range times {
+			if at%(5*time.Second) >= time.Second {
+				t.Fatalf("Arrival at %v falls in an off period", at)
+			}
+		}
+		if n := len(times); n < 900 || n > 1100 {
+			t.Errorf("Expected about 1000 arrivals, got %d", n)
+		}
+	})
+
+	t.Run("Diurnal", func(t *testing.T) {
+		period := 10 * time.Second
+		times := arrivalTimes(simulation.Diurnal(100, 0.8, period), 100*time.Second)
+
+		var high, low int
+		for _, at := range times {
+			if at%period < period/2 {
+				high++
+			} else {
+				low++
+			}
+		}
+		if n := high + low; n < 9500 || n > 10500 {
+			t.Errorf("Expected about 10000 arrivals, got %d", n)
+		}
+		if high < 2*low {
+			t.Errorf("Expected the first half of each period to be much busier, got %d vs %d", high, low)
+		}
+	})
+
+	t.Run("Zero Rate", func(t *testing.T) {
+		if times := arrivalTimes(simulation.Poisson(0), time.Second); len(times) != 0 {
+			t.Errorf("Expected no arrivals, got %d", len(times))
+		}
+	})
+}
@@ -0,0 +1,244 @@
+// Package simulation replays synthetic traffic against a limiter built by
+// ratelimiter.New on a virtual clock, so questions such as "what happens under
+// 3x burst traffic with sliding_window at 500/min?" can be answered in
+// milliseconds and with the same result on every run.
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+// Mode selects how simulated callers use the limiter
+type Mode int
+
+const (
+	// AllowMode drops every request the limiter does not admit right away
+	AllowMode Mode = iota
+
+	// WaitMode queues requests the limiter does not admit right away, in
+	// arrival order, until they are admitted or MaxWait runs out
+	WaitMode
+)
+
+// DefaultResolution is the step at which queued requests are retried in WaitMode
+const DefaultResolution = time.Millisecond
+
+// Scenario describes a single simulation run
+type Scenario struct {
+	Options    []ratelimiter.Option // options passed to ratelimiter.New; the clock is always replaced
+	Arrivals   Arrivals             // when requests arrive
+	Duration   time.Duration        // how long to simulate
+	Cost       int                  // the N passed to AllowN for each request, 1 if not set
+	Mode       Mode                 // whether denied requests are dropped or wait
+	MaxWait    time.Duration        // how long a request may wait in WaitMode, 0 for no limit
+	Resolution time.Duration        // how often queued requests are retried, DefaultResolution if not set
+	Seed       uint64               // seed of the random source used by the arrival process
+	Start      time.Time            // wall time the virtual clock starts at, the Unix epoch if not set
+}
+
+// Report summarizes a run per second of simulated time and overall
+type Report struct {
+	Seconds []Interval
+	Total   Interval
+}
+
+// Interval holds what happened during one part of the run. Arrivals are
+// counted when they arrive; admissions, denials and waits when they are decided.
+type Interval struct {
+	Start    time.Duration // offset from the start of the run
+	Arrivals int
+	Admitted int
+	Denied   int
+	Wait     WaitStats // waits of the requests admitted in the interval
+}
+
+// WaitStats describes the distribution of wait times
+type WaitStats struct {
+	Mean time.Duration
+	P50  time.Duration
+	P90  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+}
+
+// Run simulates the scenario and reports the outcome.
+// It returns an error if the limiter cannot be built from the options.
+func Run(s Scenario) (*Report, error) {
+	if s.Arrivals == nil {
+		return nil, fmt.Errorf("simulation: no arrival process")
+	}
+	if s.Cost <= 0 {
+		s.Cost = 1
+	}
+	if s.Resolution <= 0 {
+		s.Resolution = DefaultResolution
+	}
+	if s.Start.IsZero() {
+		s.Start = time.Unix(0, 0)
+	}
+
+	clock := ratelimiter.NewFakeClock(s.Start)
+	opts := append(slices.Clone(s.Options), ratelimiter.WithClock(clock))
+	limiter, err := ratelimiter.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	r := newRecorder(s.Duration)
+	rng := rand.New(rand.NewPCG(s.Seed, s.Seed))
+	var queue []time.Duration // arrival offsets of the waiting requests, oldest first
+
+	next := s.Arrivals.Next(0, rng)
+	elapsed := time.Duration(0)
+	for {
+		step := next
+		if len(queue) > 0 {
+			step = min(step, elapsed+s.Resolution)
+			if s.MaxWait > 0 {
+				step = min(step, queue[0]+s.MaxWait)
+			}
+		}
+		if step >= s.Duration || step < elapsed {
+			break
+		}
+		elapsed = step
+		clock.Set(s.Start.Add(elapsed))
+
+		if elapsed == next {
+			r.arrival(elapsed)
+			switch {
+			case s.Mode == WaitMode:
+				queue = append(queue, elapsed)
+			case limiter.AllowN(s.Cost):
+				r.admit(elapsed, 0)
+			default:
+				r.deny(elapsed)
+			}
+			gap := s.Arrivals.Next(elapsed, rng)
+			if gap <= 0 || gap > s.Duration-elapsed {
+				next = s.Duration
+			} else {
+				next = elapsed + gap
+			}
+		}
+
+		for len(queue) > 0 {
+			arrived := queue[0]
+			if limiter.AllowN(s.Cost) {
+				r.admit(elapsed, elapsed-arrived)
+			} else if s.MaxWait > 0 && elapsed-arrived >= s.MaxWait {
+				r.deny(elapsed)
+			} else {
+				break
+			}
+			queue = queue[1:]
+		}
+	}
+
+	// Requests still waiting when time runs out were never admitted
+	for range queue {
+		r.deny(s.Duration)
+	}
+	return r.report(), nil
+}
+
+// String renders the report as a table with one row per second and a total
+func (r *Report) String() string {
+	var b strings.Builder
+	// Writes to a strings.Builder cannot fail, so their errors are dropped
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintln(w, "second\tarrivals\tadmitted\tdenied\twait mean\twait p50\twait p99\twait max\t")
+	row := func(label string, i Interval) {
+		_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%v\t%v\t%v\t%v\t\n",
+			label, i.Arrivals, i.Admitted, i.Denied, i.Wait.Mean, i.Wait.P50, i.Wait.P99, i.Wait.Max)
+	}
+	for _, s := range r.Seconds {
+		row(fmt.Sprint(int(s.Start/time.Second)), s)
+	}
+	row("total", r.Total)
+	_ = w.Flush()
+	return b.String()
+}
+
+// recorder accumulates per second counts and waits during a run
+type recorder struct {
+	seconds []Interval
+	waits   [][]time.Duration
+}
+
+func newRecorder(duration time.Duration) *recorder {
+	n := max(int((duration+time.Second-1)/time.Second), 1)
+	r := &recorder{
+		seconds: make([]Interval, n),
+		waits:   make([][]time.Duration, n),
+	}
+	for i := range r.seconds {
+		r.seconds[i].Start = time.Duration(i) * time.Second
+	}
+	return r
+}
+
+// at returns the index of the second containing elapsed
+func (r *recorder) at(elapsed time.Duration) int {
+	return min(int(elapsed/time.Second), len(r.seconds)-1)
+}
+
+func (r *recorder) arrival(elapsed time.Duration) {
+	r.seconds[r.at(elapsed)].Arrivals++
+}
+
+func (r *recorder) admit(elapsed, wait time.Duration) {
+	i := r.at(elapsed)
+	r.seconds[i].Admitted++
+	r.waits[i] = append(r.waits[i], wait)
+}
+
+func (r *recorder) deny(elapsed time.Duration) {
+	r.seconds[r.at(elapsed)].Denied++
+}
+
+func (r *recorder) report() *Report {
+	report := &Report{Seconds: r.seconds}
+	var all []time.Duration
+	for i := range report.Seconds {
+		s := &report.Seconds[i]
+		s.Wait = waitStats(r.waits[i])
+		report.Total.Arrivals += s.Arrivals
+		report.Total.Admitted += s.Admitted
+		report.Total.Denied += s.Denied
+		all = append(all, r.waits[i]...)
+	}
+	report.Total.Wait = waitStats(all)
+	return report
+}
+
+func waitStats(waits []time.Duration) WaitStats {
+	if len(waits) == 0 {
+		return WaitStats{}
+	}
+	slices.Sort(waits)
+
+	var sum time.Duration
+	for _, w := range waits {
+		sum += w
+	}
+	quantile := func(q float64) time.Duration {
+		i := int(math.Ceil(q*float64(len(waits)))) - 1
+		return waits[max(i, 0)]
+	}
+	return WaitStats{
+		Mean: sum / time.Duration(len(waits)),
+		P50:  quantile(0.50),
+		P90:  quantile(0.90),
+		P99:  quantile(0.99),
+		Max:  waits[len(waits)-1],
+	}
+}
@@ -0,0 +1,122 @@
+package simulation_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+	"github.com/popeskul/ratelimiter/simulation"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("Allow Mode", func(t *testing.T) {
+		report, err := simulation.Run(simulation.Scenario{
+			Options: []ratelimiter.Option{
+				ratelimiter.WithAlgorithm("fixed_window"),
+				ratelimiter.WithRate(5),
+				ratelimiter.WithWindow(time.Second),
+			},
+			Arrivals: simulation.Constant(10),
+			Duration: 10 * time.Second,
+		})
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		if len(report.Seconds) != 10 {
+			t.Fatalf("Expected 10 seconds in the report, got %d", len(report.Seconds))
+		}
+		for _, s := range report.Seconds[1:] {
+			if s.Arrivals != 10 || s.Admitted != 5 || s.Denied != 5 {
+				t.Errorf("Second %v: expected 10 arrivals, 5 admitted and 5 denied, got %+v", s.Start, s)
+			}
+		}
+		if report.Total.Admitted+report.Total.Denied != report.Total.Arrivals {
+			t.Errorf("Every arrival should be admitted or denied, got %+v", report.Total)
+		}
+		if report.Total.Wait.Max != 0 {
+			t.Errorf("Requests should not wait in allow mode, got %v", report.Total.Wait.Max)
+		}
+	})
+
+	t.Run("Wait Mode", func(t *testing.T) {
+		report, err := simulation.Run(simulation.Scenario{
+			Options: []ratelimiter.Option{
+				ratelimiter.WithAlgorithm("gcra"),
+				ratelimiter.WithRate(10),
+				ratelimiter.WithWindow(time.Second),
+			},
+			Arrivals: simulation.Constant(20),
+			Duration: 5 * time.Second,
+			Mode:     simulation.WaitMode,
+			MaxWait:  500 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+
+		if report.Total.Denied == 0 {
+			t.Error("Requests waiting longer than MaxWait should be denied")
+		}
+		if report.Total.Wait.Max <= 0 || report.Total.Wait.Max > 500*time.Millisecond {
+			t.Errorf("Expected waits of up to 500ms, got %v", report.Total.Wait.Max)
+		}
+		for _, s := range report.Seconds {
+			if s.Admitted > 11 {
+				t.Errorf("Second %v: expected at most 11 admitted, got %d", s.Start, s.Admitted)
+			}
+		}
+	})
+
+	t.Run("Deterministic", func(t *testing.T) {
+		scenario := simulation.Scenario{
+			Options: []ratelimiter.Option{
+				ratelimiter.WithAlgorithm("sliding_window"),
+				ratelimiter.WithRate(500),
+				ratelimiter.WithWindow(time.Minute),
+			},
+			Arrivals: simulation.Bursty(30, 2*time.Second, 3*time.Second),
+			Duration: 30 * time.Second,
+			Mode:     simulation.WaitMode,
+			MaxWait:  time.Second,
+			Seed:     42,
+		}
+
+		first, err := simulation.Run(scenario)
+		if err != nil {
+			t.Fatalf("Run failed: %v", err)
+		}
+		second, _ := simulation.Run(scenario)
+		if !reflect.DeepEqual(first, second) {
+			t.Error("Runs with the same seed should produce the same report")
+		}
+	})
+
+	t.Run("Invalid Options", func(t *testing.T) {
+		_, err := simulation.Run(simulation.Scenario{
+			Options:  []ratelimiter.Option{ratelimiter.WithAlgorithm("invalid")},
+			Arrivals: simulation.Constant(1),
+			Duration: time.Second,
+		})
+		if err != ratelimiter.ErrUnsupportedAlgorithm {
+			t.Errorf("Expected ErrUnsupportedAlgorithm, got %v", err)
+		}
+	})
+
+	t.Run("String", func(t *testing.T) {
+		report, _ := simulation.Run(simulation.Scenario{
+			Arrivals: simulation.Poisson(50),
+			Duration: 3 * time.Second,
+		})
+
+		lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+		if len(lines) != 5 {
+			t.Fatalf("Expected a header, 3 seconds and a total, got:\n%s", report)
+		}
+		if !strings.HasPrefix(strings.TrimSpace(lines[4]), "total") {
+			t.Errorf("Expected the last row to be the total, got %q", lines[4])
+		}
+	})
+}
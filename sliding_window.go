@@ -2,6 +2,7 @@ package ratelimiter
 
 import (
 	"context"
+	"slices"
 	"sync"
 	"time"
 )
@@ -10,6 +11,10 @@ type SlidingWindow struct {
 	rate     int
 	window   time.Duration
 	requests []time.Time
+	changed  notifier
+	closed   closer
+	waiters  waitQueue
+	clock    Clock
 	mu       sync.Mutex
 }
 
@@ -18,14 +23,20 @@ func NewSlidingWindow(config *Config) *SlidingWindow {
 		rate:     config.Rate,
 		window:   config.Window,
 		requests: make([]time.Time, 0, config.Rate),
+		clock:    config.clockOrDefault(),
+		waiters:  newWaitQueue(config.MaxWaiters),
 	}
 }
 
 func (sw *SlidingWindow) Allow() bool {
+	if sw.closed.isClosed() {
+		return false
+	}
+
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
-	now := time.Now()
+	now := sw.clock.Now()
 	sw.clearExpired(now)
 
 	if len(sw.requests) < sw.rate {
@@ -36,51 +47,120 @@ func (sw *SlidingWindow) Allow() bool {
 }
 
 func (sw *SlidingWindow) AllowN(n int) bool {
+	return sw.AllowDecision(n).Allowed
+}
+
+// AllowDecision admits N requests if the window has room for them
+func (sw *SlidingWindow) AllowDecision(n int) Decision {
+	if sw.closed.isClosed() {
+		return closedDecision()
+	}
+
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
-	now := time.Now()
+	now := sw.clock.Now()
 	sw.clearExpired(now)
 
-	if len(sw.requests)+n <= sw.rate {
+	d := Decision{Limit: int64(sw.rate)}
+	switch {
+	case len(sw.requests)+n <= sw.rate:
 		for i := 0; i < n; i++ {
 			sw.requests = append(sw.requests, now)
 		}
-		return true
+		d.Allowed = true
+	case n > sw.rate:
+		d.RetryAfter = InfDuration
+	default:
+		d.RetryAfter = sw.timeToAllow(now, n)
 	}
-	return false
+	d.Remaining = int64(max(sw.rate-len(sw.requests), 0))
+	d.ResetAt = now
+	if len(sw.requests) > 0 {
+		d.ResetAt = sw.requests[len(sw.requests)-1].Add(sw.window)
+	}
+	return d
+}
+
+func (sw *SlidingWindow) Admit() error {
+	return sw.AdmitN(1)
+}
+
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (sw *SlidingWindow) AdmitN(n int) error {
+	if sw.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	return sw.AllowDecision(n).Err()
 }
 
 func (sw *SlidingWindow) Wait(ctx context.Context) error {
+	waiting := false
 	for {
+		if sw.closed.isClosed() {
+			return ErrLimiterClosed
+		}
+
 		sw.mu.Lock()
-		now := time.Now()
+		now := sw.clock.Now()
 		sw.clearExpired(now)
 
+		if sw.rate < 1 {
+			sw.mu.Unlock()
+			return ErrExceedsLimit
+		}
 		if len(sw.requests) < sw.rate {
 			sw.requests = append(sw.requests, now)
 			sw.mu.Unlock()
 			return nil
 		}
 
-		nextExpiry := sw.requests[0].Add(sw.window)
+		delay := sw.timeToAllow(now, 1)
 		sw.mu.Unlock()
 
+		if err := checkDeadline(ctx, now, delay); err != nil {
+			return err
+		}
+		if !waiting {
+			if !sw.waiters.enter() {
+				return ErrTooManyWaiters
+			}
+			defer sw.waiters.leave()
+			waiting = true
+		}
+
+		timer := sw.clock.NewTimer(delay)
 		select {
-		case <-time.After(nextExpiry.Sub(now)):
+		case <-timer.C():
 			// Continue and try again
+		case <-sw.changed.wait():
+			// Limits changed; try again
+			timer.Stop()
 		case <-ctx.Done():
+			timer.Stop()
 			return ctx.Err()
+		case <-sw.closed.done():
+			timer.Stop()
+			return ErrLimiterClosed
 		}
 	}
 }
 
 func (sw *SlidingWindow) WaitN(ctx context.Context, n int) error {
+	waiting := false
 	for {
+		if sw.closed.isClosed() {
+			return ErrLimiterClosed
+		}
+
 		sw.mu.Lock()
-		now := time.Now()
+		now := sw.clock.Now()
 		sw.clearExpired(now)
 
+		if n > sw.rate {
+			sw.mu.Unlock()
+			return ErrExceedsLimit
+		}
 		if len(sw.requests)+n <= sw.rate {
 			for i := 0; i < n; i++ {
 				sw.requests = append(sw.requests, now)
@@ -89,18 +169,116 @@ func (sw *SlidingWindow) WaitN(ctx context.Context, n int) error {
 			return nil
 		}
 
-		nextExpiry := sw.requests[0].Add(sw.window)
+		delay := sw.timeToAllow(now, n)
 		sw.mu.Unlock()
 
+		if err := checkDeadline(ctx, now, delay); err != nil {
+			return err
+		}
+		if !waiting {
+			if !sw.waiters.enter() {
+				return ErrTooManyWaiters
+			}
+			defer sw.waiters.leave()
+			waiting = true
+		}
+
+		timer := sw.clock.NewTimer(delay)
 		select {
-		case <-time.After(nextExpiry.Sub(now)):
+		case <-timer.C():
 			// Continue and try again
+		case <-sw.changed.wait():
+			// Limits changed; try again
+			timer.Stop()
 		case <-ctx.Done():
+			timer.Stop()
 			return ctx.Err()
+		case <-sw.closed.done():
+			timer.Stop()
+			return ErrLimiterClosed
+		}
+	}
+}
+
+func (sw *SlidingWindow) Reserve() *Reservation {
+	return sw.ReserveN(1)
+}
+
+// ReserveN records N requests at the earliest time the window has room for
+// them, which may be in the future. N larger than the rate can never be satisfied.
+func (sw *SlidingWindow) ReserveN(n int) *Reservation {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed.isClosed() || n > sw.rate {
+		return &Reservation{}
+	}
+
+	now := sw.clock.Now()
+	sw.clearExpired(now)
+
+	timeToAct := now
+	if excess := len(sw.requests) + n - sw.rate; excess > 0 {
+		// The excess oldest requests have to leave the window first
+		timeToAct = sw.requests[excess-1].Add(sw.window + 1)
+	}
+	if last := len(sw.requests) - 1; last >= 0 && sw.requests[last].After(timeToAct) {
+		// Keep requests sorted behind earlier reservations
+		timeToAct = sw.requests[last]
+	}
+
+	for i := 0; i < n; i++ {
+		sw.requests = append(sw.requests, timeToAct)
+	}
+	return newReservation(sw.clock, n, timeToAct, func(tokens int) {
+		sw.mu.Lock()
+		defer sw.mu.Unlock()
+		if tokens < 0 {
+			sw.remove(timeToAct, -tokens)
+			return
+		}
+		// Charge at the reservation time, or now if that has already left the window
+		now := sw.clock.Now()
+		t := timeToAct
+		if t.Before(now.Add(-sw.window)) {
+			t = now
+		}
+		sw.insert(t, tokens)
+	})
+}
+
+// insert records n requests at t, keeping requests sorted; the caller holds sw.mu
+func (sw *SlidingWindow) insert(t time.Time, n int) {
+	i := len(sw.requests)
+	for i > 0 && sw.requests[i-1].After(t) {
+		i--
+	}
+	sw.requests = slices.Insert(sw.requests, i, slices.Repeat([]time.Time{t}, n)...)
+}
+
+// remove deletes up to n requests recorded at t; the caller holds sw.mu
+func (sw *SlidingWindow) remove(t time.Time, n int) {
+	for i := len(sw.requests) - 1; i >= 0 && n > 0; i-- {
+		if sw.requests[i].Equal(t) {
+			sw.requests = append(sw.requests[:i], sw.requests[i+1:]...)
+			n--
+		} else if sw.requests[i].Before(t) {
+			return
 		}
 	}
 }
 
+// timeToAllow returns how long until N more requests fit in the window, which
+// is when the oldest requests in the way expire. N must not exceed the rate;
+// the caller holds sw.mu
+func (sw *SlidingWindow) timeToAllow(now time.Time, n int) time.Duration {
+	excess := len(sw.requests) + n - sw.rate
+	if excess <= 0 {
+		return 0
+	}
+	return sw.requests[excess-1].Add(sw.window + 1).Sub(now)
+}
+
 func (sw *SlidingWindow) clearExpired(now time.Time) {
 	cutoff := now.Add(-sw.window)
 	i := 0
@@ -117,11 +295,42 @@ func (sw *SlidingWindow) Reset() {
 	sw.requests = sw.requests[:0]
 }
 
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (sw *SlidingWindow) Close() error {
+	sw.closed.close()
+	return nil
+}
+
+// SetRate changes the number of requests allowed per window. Requests already
+// recorded in the window are kept.
+func (sw *SlidingWindow) SetRate(rate int) {
+	sw.mu.Lock()
+	sw.rate = rate
+	sw.mu.Unlock()
+	sw.changed.notify()
+}
+
+// SetBurst has no effect on a SlidingWindow
+func (sw *SlidingWindow) SetBurst(int) {}
+
+// SetCapacity has no effect on a SlidingWindow
+func (sw *SlidingWindow) SetCapacity(int) {}
+
+// SetWindow changes the window length. Recorded requests are kept and expire
+// according to the new length.
+func (sw *SlidingWindow) SetWindow(window time.Duration) {
+	sw.mu.Lock()
+	sw.window = window
+	sw.mu.Unlock()
+	sw.changed.notify()
+}
+
 func (sw *SlidingWindow) GetMetrics() Metrics {
 	sw.mu.Lock()
 	defer sw.mu.Unlock()
 
-	now := time.Now()
+	now := sw.clock.Now()
 	sw.clearExpired(now)
 
 	return Metrics{
@@ -135,5 +344,7 @@ func (sw *SlidingWindow) GetMetrics() Metrics {
 		WindowDuration:  sw.window,
 		InnerRate:       0,
 		InnerWindow:     0,
+		Remaining:       int64(sw.rate - len(sw.requests)),
+		QueueDepth:      sw.waiters.len(),
 	}
 }
@@ -0,0 +1,281 @@
+package ratelimiter
+
+import (
+	"context"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SlidingWindowCounter approximates a sliding window with two fixed-window
+// counters: the previous window's count is weighted by how much of it still
+// overlaps the sliding window. Memory use is constant regardless of Rate.
+// Having no counters for later windows, it does not implement Reserver.
+type SlidingWindowCounter struct {
+	rate         int64
+	window       time.Duration
+	windowStart  int64
+	currCount    int64
+	prevCount    int64
+	allowedCount int64
+	deniedCount  int64
+	changed      notifier
+	closed       closer
+	waiters      waitQueue
+	clock        Clock
+	mu           sync.Mutex
+}
+
+func NewSlidingWindowCounter(config *Config) *SlidingWindowCounter {
+	clock := config.clockOrDefault()
+	return &SlidingWindowCounter{
+		rate:        int64(config.Rate),
+		window:      config.Window,
+		windowStart: clock.Now().UnixNano(),
+		clock:       clock,
+		waiters:     newWaitQueue(config.MaxWaiters),
+	}
+}
+
+func (sc *SlidingWindowCounter) Allow() bool {
+	return sc.AllowN(1)
+}
+
+func (sc *SlidingWindowCounter) AllowN(n int) bool {
+	return sc.AllowDecision(n).Allowed
+}
+
+// AllowDecision admits N requests if they fit under the weighted count
+func (sc *SlidingWindowCounter) AllowDecision(n int) Decision {
+	if sc.closed.isClosed() {
+		return closedDecision()
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	now := sc.clock.Now().UnixNano()
+	d := Decision{Limit: sc.rate}
+	if d.RetryAfter = sc.timeToAllow(now, int64(n)); d.RetryAfter == 0 {
+		sc.currCount += int64(n)
+		atomic.AddInt64(&sc.allowedCount, 1)
+		d.Allowed = true
+	} else {
+		atomic.AddInt64(&sc.deniedCount, 1)
+	}
+	d.Remaining = max(sc.remaining(now), 0)
+	d.ResetAt = time.Unix(0, sc.windowStart+sc.window.Nanoseconds())
+	return d
+}
+
+func (sc *SlidingWindowCounter) Admit() error {
+	return sc.AdmitN(1)
+}
+
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (sc *SlidingWindowCounter) AdmitN(n int) error {
+	if sc.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	return sc.AllowDecision(n).Err()
+}
+
+func (sc *SlidingWindowCounter) Wait(ctx context.Context) error {
+	return sc.WaitN(ctx, 1)
+}
+
+func (sc *SlidingWindowCounter) WaitN(ctx context.Context, n int) error {
+	waiting := false
+	for {
+		if sc.closed.isClosed() {
+			return ErrLimiterClosed
+		}
+
+		sc.mu.Lock()
+		if int64(n) > sc.rate {
+			sc.mu.Unlock()
+			atomic.AddInt64(&sc.deniedCount, 1)
+			return ErrExceedsLimit
+		}
+		now := sc.clock.Now()
+		delay := sc.timeToAllow(now.UnixNano(), int64(n))
+		if delay == 0 {
+			sc.currCount += int64(n)
+			sc.mu.Unlock()
+			atomic.AddInt64(&sc.allowedCount, 1)
+			return nil
+		}
+		sc.mu.Unlock()
+
+		if err := checkDeadline(ctx, now, delay); err != nil {
+			atomic.AddInt64(&sc.deniedCount, 1)
+			return err
+		}
+		if !waiting {
+			if !sc.waiters.enter() {
+				atomic.AddInt64(&sc.deniedCount, 1)
+				return ErrTooManyWaiters
+			}
+			defer sc.waiters.leave()
+			waiting = true
+		}
+
+		timer := sc.clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+			// Continue and try again
+		case <-sc.changed.wait():
+			timer.Stop()
+		case <-ctx.Done():
+			timer.Stop()
+			atomic.AddInt64(&sc.deniedCount, 1)
+			return ctx.Err()
+		case <-sc.closed.done():
+			timer.Stop()
+			atomic.AddInt64(&sc.deniedCount, 1)
+			return ErrLimiterClosed
+		}
+	}
+}
+
+func (sc *SlidingWindowCounter) Reset() {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.windowStart = sc.clock.Now().UnixNano()
+	sc.currCount = 0
+	sc.prevCount = 0
+	atomic.StoreInt64(&sc.allowedCount, 0)
+	atomic.StoreInt64(&sc.deniedCount, 0)
+}
+
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (sc *SlidingWindowCounter) Close() error {
+	sc.closed.close()
+	return nil
+}
+
+// SetRate changes the number of requests allowed per window. Both counters are kept.
+func (sc *SlidingWindowCounter) SetRate(rate int) {
+	sc.mu.Lock()
+	sc.rate = int64(rate)
+	sc.mu.Unlock()
+	sc.changed.notify()
+}
+
+// SetBurst has no effect on a SlidingWindowCounter
+func (sc *SlidingWindowCounter) SetBurst(int) {}
+
+// SetCapacity has no effect on a SlidingWindowCounter
+func (sc *SlidingWindowCounter) SetCapacity(int) {}
+
+// SetWindow changes the window length. The current window keeps its start and
+// both counters are kept. Without a positive window nothing is remembered
+// between requests.
+func (sc *SlidingWindowCounter) SetWindow(window time.Duration) {
+	sc.mu.Lock()
+	sc.window = window
+	sc.mu.Unlock()
+	sc.changed.notify()
+}
+
+func (sc *SlidingWindowCounter) GetMetrics() Metrics {
+	sc.mu.Lock()
+	now := sc.clock.Now().UnixNano()
+	sc.advance(now)
+	windowStart := sc.windowStart
+	rate := sc.rate
+	window := sc.window
+	remaining := sc.remaining(now)
+	sc.mu.Unlock()
+
+	return Metrics{
+		TotalRequests:   atomic.LoadInt64(&sc.allowedCount) + atomic.LoadInt64(&sc.deniedCount),
+		AllowedRequests: atomic.LoadInt64(&sc.allowedCount),
+		DeniedRequests:  atomic.LoadInt64(&sc.deniedCount),
+		CurrentRate:     rate,
+		LastResetTime:   windowStart,
+		TotalWaitTime:   0, // SlidingWindowCounter doesn't track wait time
+		MaxWaitTime:     0, // SlidingWindowCounter doesn't track max wait time
+		WindowDuration:  window,
+		InnerRate:       0, // Not applicable for SlidingWindowCounter
+		InnerWindow:     0, // Not applicable for SlidingWindowCounter
+		Remaining:       remaining,
+		QueueDepth:      sc.waiters.len(),
+	}
+}
+
+// remaining returns how many requests fit under the weighted count at now,
+// which must be in the current window; the caller holds sc.mu
+func (sc *SlidingWindowCounter) remaining(now int64) int64 {
+	window := sc.window.Nanoseconds()
+	if window <= 0 {
+		return sc.rate - sc.currCount
+	}
+	weighted := float64(sc.prevCount) * float64(window-(now-sc.windowStart)) / float64(window)
+	return sc.rate - sc.currCount - int64(math.Ceil(weighted))
+}
+
+// advance rolls the counters forward to the window containing now; the caller holds sc.mu
+func (sc *SlidingWindowCounter) advance(now int64) {
+	window := sc.window.Nanoseconds()
+	if window <= 0 {
+		sc.windowStart = now
+		sc.currCount = 0
+		sc.prevCount = 0
+		return
+	}
+	elapsed := now - sc.windowStart
+	if elapsed < window {
+		return
+	}
+	if elapsed < 2*window {
+		sc.prevCount = sc.currCount
+	} else {
+		sc.prevCount = 0
+	}
+	sc.currCount = 0
+	sc.windowStart += elapsed / window * window
+}
+
+// timeToAllow returns how long until N more requests fit under the weighted
+// count, or 0 if they fit now; the caller holds sc.mu
+func (sc *SlidingWindowCounter) timeToAllow(now, n int64) time.Duration {
+	sc.advance(now)
+
+	window := sc.window.Nanoseconds()
+	elapsed := now - sc.windowStart
+	room := sc.rate - sc.currCount - n
+	if window <= 0 {
+		if room < 0 {
+			return InfDuration
+		}
+		return 0
+	}
+	if room < 0 {
+		// Nothing fits until the current window becomes the previous one, and
+		// then only once enough of it has slid out
+		untilNext := window - elapsed
+		room = sc.rate - n
+		switch {
+		case room < 0:
+			return InfDuration
+		case sc.currCount <= room:
+			return time.Duration(untilNext)
+		}
+		return time.Duration(untilNext + window - int64(float64(room)*float64(window)/float64(sc.currCount)))
+	}
+
+	// prev * (window - elapsed) / window + curr + n <= rate
+	weighted := float64(sc.prevCount) * float64(window-elapsed) / float64(window)
+	if weighted <= float64(room) {
+		return 0
+	}
+	needed := window - int64(float64(room)*float64(window)/float64(sc.prevCount))
+	if needed <= elapsed {
+		needed = elapsed + 1
+	}
+	return time.Duration(needed - elapsed)
+}
@@ -0,0 +1,139 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"github.com/popeskul/ratelimiter"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowCounter(t *testing.T) {
+	t.Run("Basic Allow", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(ratelimiter.SlidingWindowCounterAlgorithm),
+			ratelimiter.WithRate(10),
+			ratelimiter.WithWindow(time.Second),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+
+		for i := 0; i < 10; i++ {
+			if !limiter.Allow() {
+				t.Errorf("Request %d should be allowed", i+1)
+			}
+		}
+
+		if limiter.Allow() {
+			t.Error("Request should be denied")
+		}
+	})
+
+	t.Run("AllowN", func(t *testing.T) {
+		limiter := ratelimiter.NewSlidingWindowCounter(&ratelimiter.Config{
+			Rate:   10,
+			Window: time.Second,
+		})
+
+		if !limiter.AllowN(5) {
+			t.Error("AllowN(5) should be allowed")
+		}
+		if !limiter.AllowN(5) {
+			t.Error("AllowN(5) should be allowed")
+		}
+		if limiter.AllowN(1) {
+			t.Error("AllowN(1) should be denied")
+		}
+	})
+
+	t.Run("Weighted Previous Window", func(t *testing.T) {
+		limiter := ratelimiter.NewSlidingWindowCounter(&ratelimiter.Config{
+			Rate:   10,
+			Window: 100 * time.Millisecond,
+		})
+
+		limiter.AllowN(10)
+
+		// Early in the next window most of the previous window still counts
+		time.Sleep(110 * time.Millisecond)
+		if limiter.AllowN(5) {
+			t.Error("AllowN(5) should be denied while the previous window mostly overlaps")
+		}
+
+		// Two windows later the previous count no longer applies
+		time.Sleep(200 * time.Millisecond)
+		if !limiter.AllowN(10) {
+			t.Error("AllowN(10) should be allowed once the previous window has slid out")
+		}
+	})
+
+	t.Run("Wait", func(t *testing.T) {
+		limiter := ratelimiter.NewSlidingWindowCounter(&ratelimiter.Config{
+			Rate:   2,
+			Window: 100 * time.Millisecond,
+		})
+
+		limiter.AllowN(2)
+
+		start := time.Now()
+		if err := limiter.Wait(context.Background()); err != nil {
+			t.Errorf("Wait should not error: %v", err)
+		}
+		if duration := time.Since(start); duration < 50*time.Millisecond {
+			t.Errorf("Expected to wait at least 50ms, but waited %v", duration)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if err := limiter.WaitN(ctx, 2); err == nil {
+			t.Error("WaitN should time out")
+		}
+	})
+
+	t.Run("Reset", func(t *testing.T) {
+		limiter := ratelimiter.NewSlidingWindowCounter(&ratelimiter.Config{
+			Rate:   2,
+			Window: time.Second,
+		})
+
+		limiter.AllowN(2)
+		if limiter.Allow() {
+			t.Error("Request should be denied before reset")
+		}
+
+		limiter.Reset()
+
+		if !limiter.AllowN(2) {
+			t.Error("AllowN(2) should be allowed after reset")
+		}
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		limiter := ratelimiter.NewSlidingWindowCounter(&ratelimiter.Config{
+			Rate:   100,
+			Window: time.Second,
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 1000; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				limiter.Allow()
+			}()
+		}
+		wg.Wait()
+
+		metrics := limiter.GetMetrics()
+		if metrics.AllowedRequests != 100 {
+			t.Errorf("Expected 100 allowed requests, got %d", metrics.AllowedRequests)
+		}
+		if metrics.DeniedRequests != 900 {
+			t.Errorf("Expected 900 denied requests, got %d", metrics.DeniedRequests)
+		}
+		if metrics.WindowDuration != time.Second {
+			t.Errorf("Expected window duration 1s, got %v", metrics.WindowDuration)
+		}
+	})
+}
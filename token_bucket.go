@@ -2,51 +2,171 @@ package ratelimiter
 
 import (
 	"context"
+	"math"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 type TokenBucket struct {
-	rate           float64
-	capacity       float64
+	rate           int64 // tokens added per second
+	capacity       int64
 	tokens         int64
 	lastRefillTime int64
-	refillInterval time.Duration
+	lastEvent      int64 // unix nanos of the latest time to act of any reservation
+	refillInterval int64
 	allowedCount   int64
 	deniedCount    int64
+	changed        notifier
+	closed         closer
+	waiters        waitQueue
+	clock          Clock
+	mu             sync.Mutex // serializes setters
 }
 
 func NewTokenBucket(config *Config) *TokenBucket {
-	refillInterval := time.Second
-	if config.Rate > 0 {
-		refillInterval = time.Duration(float64(time.Second) / float64(config.Rate))
-	}
+	clock := config.clockOrDefault()
 	return &TokenBucket{
-		rate:           float64(config.Rate),
-		capacity:       float64(config.Capacity),
+		rate:           int64(config.Rate),
+		capacity:       int64(config.Capacity),
 		tokens:         int64(config.Capacity),
-		lastRefillTime: time.Now().UnixNano(),
-		refillInterval: refillInterval,
+		lastRefillTime: clock.Now().UnixNano(),
+		refillInterval: int64(refillInterval(config.Rate)),
+		clock:          clock,
+		waiters:        newWaitQueue(config.MaxWaiters),
 	}
 }
 
+func refillInterval(rate int) time.Duration {
+	if rate > 0 {
+		return time.Duration(float64(time.Second) / float64(rate))
+	}
+	return time.Second
+}
+
 func (tb *TokenBucket) Allow() bool {
 	return tb.AllowN(1)
 }
 
 func (tb *TokenBucket) AllowN(n int) bool {
-	now := time.Now().UnixNano()
-	tb.refill(now)
+	if tb.closed.isClosed() {
+		return false
+	}
+
+	tb.refill(tb.clock.Now().UnixNano())
+	_, ok := tb.take(int64(n))
+	return ok
+}
 
-	available := atomic.LoadInt64(&tb.tokens)
-	if available >= int64(n) {
-		if atomic.AddInt64(&tb.tokens, -int64(n)) >= 0 {
+// take removes N tokens if the bucket holds that many and returns the tokens
+// it left, or found if it holds fewer
+func (tb *TokenBucket) take(n int64) (int64, bool) {
+	for {
+		tokens := atomic.LoadInt64(&tb.tokens)
+		if tokens < n {
+			atomic.AddInt64(&tb.deniedCount, 1)
+			return tokens, false
+		}
+		if atomic.CompareAndSwapInt64(&tb.tokens, tokens, tokens-n) {
 			atomic.AddInt64(&tb.allowedCount, 1)
-			return true
+			return tokens - n, true
+		}
+	}
+}
+
+func (tb *TokenBucket) Admit() error {
+	return tb.AdmitN(1)
+}
+
+// AdmitN admits N requests or returns a *RateLimitError describing the denial
+func (tb *TokenBucket) AdmitN(n int) error {
+	if tb.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	return tb.AllowDecision(n).Err()
+}
+
+// AllowDecision admits N requests if the bucket holds enough tokens. The
+// state reported is the one the admission left, or found if it was denied.
+func (tb *TokenBucket) AllowDecision(n int) Decision {
+	if tb.closed.isClosed() {
+		return closedDecision()
+	}
+
+	now := tb.clock.Now()
+	tb.refill(now.UnixNano())
+	capacity := atomic.LoadInt64(&tb.capacity)
+	rate := atomic.LoadInt64(&tb.rate)
+	tokens, ok := tb.take(int64(n))
+
+	d := Decision{Allowed: ok, Limit: capacity, Remaining: max(tokens, 0)}
+	if !d.Allowed {
+		d.RetryAfter = InfDuration
+	}
+	if rate > 0 {
+		refillTime := func(tokens int64) time.Duration {
+			return time.Duration(float64(max(tokens, 0)) / float64(rate) * float64(time.Second))
+		}
+		if !d.Allowed && int64(n) <= capacity {
+			d.RetryAfter = refillTime(int64(n) - tokens)
+		}
+		d.ResetAt = now.Add(refillTime(capacity - tokens))
+	}
+	return d
+}
+
+func (tb *TokenBucket) Reserve() *Reservation {
+	return tb.ReserveN(1)
+}
+
+// ReserveN takes N tokens now, letting the bucket go into deficit, and reports
+// when the deficit will have been refilled. N larger than the capacity can
+// never be satisfied.
+func (tb *TokenBucket) ReserveN(n int) *Reservation {
+	if tb.closed.isClosed() {
+		return &Reservation{}
+	}
+
+	now := tb.clock.Now()
+	rate := atomic.LoadInt64(&tb.rate)
+	if int64(n) > atomic.LoadInt64(&tb.capacity) || rate <= 0 {
+		atomic.AddInt64(&tb.deniedCount, 1)
+		return &Reservation{}
+	}
+
+	tb.refill(now.UnixNano())
+	remaining := atomic.AddInt64(&tb.tokens, -int64(n))
+	atomic.AddInt64(&tb.allowedCount, 1)
+
+	var delay time.Duration
+	if remaining < 0 {
+		delay = time.Duration(float64(-remaining) / float64(rate) * float64(time.Second))
+	}
+	timeToAct := now.Add(delay)
+	for last := atomic.LoadInt64(&tb.lastEvent); timeToAct.UnixNano() > last; last = atomic.LoadInt64(&tb.lastEvent) {
+		if atomic.CompareAndSwapInt64(&tb.lastEvent, last, timeToAct.UnixNano()) {
+			break
 		}
 	}
-	atomic.AddInt64(&tb.deniedCount, 1)
-	return false
+
+	r := newReservation(tb.clock, n, timeToAct, tb.adjust)
+	r.refund = func(tokens int) { tb.refund(tokens, timeToAct) }
+	return r
+}
+
+// refund gives back the tokens of a reservation canceled before its time to
+// act. Tokens that reservations acting after it were promised stay taken, so
+// that those reservations and new requests cannot both use them.
+func (tb *TokenBucket) refund(tokens int, timeToAct time.Time) {
+	if tb.clock.Now().After(timeToAct) {
+		return
+	}
+	rate := atomic.LoadInt64(&tb.rate)
+	later := time.Duration(atomic.LoadInt64(&tb.lastEvent) - timeToAct.UnixNano())
+	promised := int64(math.Round(later.Seconds() * float64(rate)))
+	if restore := int64(tokens) - promised; restore > 0 {
+		tb.adjust(-int(restore))
+	}
 }
 
 func (tb *TokenBucket) Wait(ctx context.Context) error {
@@ -54,66 +174,157 @@ func (tb *TokenBucket) Wait(ctx context.Context) error {
 }
 
 func (tb *TokenBucket) WaitN(ctx context.Context, n int) error {
+	if tb.closed.isClosed() {
+		return ErrLimiterClosed
+	}
+	if int64(n) > atomic.LoadInt64(&tb.capacity) {
+		return ErrExceedsLimit
+	}
 	if tb.AllowN(n) {
 		return nil
 	}
 
-	timer := time.NewTimer(tb.timeToToken(float64(n)))
+	delay := tb.timeToToken(float64(n))
+	if err := checkDeadline(ctx, tb.clock.Now(), delay); err != nil {
+		return err
+	}
+	if !tb.waiters.enter() {
+		return ErrTooManyWaiters
+	}
+	defer tb.waiters.leave()
+
+	timer := tb.clock.NewTimer(delay)
 	defer timer.Stop()
 
 	for {
 		select {
-		case <-timer.C:
-			if tb.AllowN(n) {
-				return nil
-			}
-			timer.Reset(tb.timeToToken(float64(n)))
+		case <-timer.C():
+		case <-tb.changed.wait():
+			timer.Stop()
 		case <-ctx.Done():
 			return ctx.Err()
+		case <-tb.closed.done():
+			return ErrLimiterClosed
 		}
+		if tb.AllowN(n) {
+			return nil
+		}
+		delay = tb.timeToToken(float64(n))
+		if err := checkDeadline(ctx, tb.clock.Now(), delay); err != nil {
+			return err
+		}
+		timer.Reset(delay)
 	}
 }
 
 func (tb *TokenBucket) Reset() {
-	atomic.StoreInt64(&tb.tokens, int64(tb.capacity))
-	atomic.StoreInt64(&tb.lastRefillTime, time.Now().UnixNano())
+	atomic.StoreInt64(&tb.tokens, atomic.LoadInt64(&tb.capacity))
+	atomic.StoreInt64(&tb.lastRefillTime, tb.clock.Now().UnixNano())
+	atomic.StoreInt64(&tb.lastEvent, 0)
 	atomic.StoreInt64(&tb.allowedCount, 0)
 	atomic.StoreInt64(&tb.deniedCount, 0)
 }
 
+// Close wakes every caller blocked in Wait with ErrLimiterClosed and makes
+// later calls fail. Closing a closed limiter has no effect.
+func (tb *TokenBucket) Close() error {
+	tb.closed.close()
+	return nil
+}
+
+// SetRate changes the refill rate. Tokens accumulated at the old rate are kept.
+func (tb *TokenBucket) SetRate(rate int) {
+	tb.mu.Lock()
+	now := tb.clock.Now().UnixNano()
+	tb.refill(now)
+	atomic.StoreInt64(&tb.lastRefillTime, now)
+	atomic.StoreInt64(&tb.rate, int64(rate))
+	atomic.StoreInt64(&tb.refillInterval, int64(refillInterval(rate)))
+	tb.mu.Unlock()
+	tb.changed.notify()
+}
+
+// SetBurst has no effect; the burst of a TokenBucket is its capacity
+func (tb *TokenBucket) SetBurst(int) {}
+
+// SetCapacity changes the bucket size, scaling the tokens it holds so that the
+// bucket stays equally full. A deficit from reservations is kept as is.
+func (tb *TokenBucket) SetCapacity(capacity int) {
+	tb.mu.Lock()
+	tb.refill(tb.clock.Now().UnixNano())
+	oldCapacity := atomic.SwapInt64(&tb.capacity, int64(capacity))
+	for oldCapacity > 0 {
+		// Admissions don't take tb.mu, so retry until the scaled count is stored
+		// over the count it was computed from
+		tokens := atomic.LoadInt64(&tb.tokens)
+		if tokens <= 0 {
+			break
+		}
+		scaled := int64(float64(tokens) * float64(capacity) / float64(oldCapacity))
+		if atomic.CompareAndSwapInt64(&tb.tokens, tokens, min(scaled, int64(capacity))) {
+			break
+		}
+	}
+	tb.mu.Unlock()
+	tb.changed.notify()
+}
+
+// SetWindow has no effect; a TokenBucket refills continuously
+func (tb *TokenBucket) SetWindow(time.Duration) {}
+
 func (tb *TokenBucket) GetMetrics() Metrics {
 	return Metrics{
 		TotalRequests:   atomic.LoadInt64(&tb.allowedCount) + atomic.LoadInt64(&tb.deniedCount),
 		AllowedRequests: atomic.LoadInt64(&tb.allowedCount),
 		DeniedRequests:  atomic.LoadInt64(&tb.deniedCount),
-		CurrentRate:     int64(tb.rate),
+		CurrentRate:     atomic.LoadInt64(&tb.rate),
 		LastResetTime:   atomic.LoadInt64(&tb.lastRefillTime),
 		TotalWaitTime:   0, // TokenBucket doesn't track total wait time
 		MaxWaitTime:     0, // TokenBucket doesn't track max wait time
-		WindowDuration:  tb.refillInterval,
+		WindowDuration:  time.Duration(atomic.LoadInt64(&tb.refillInterval)),
 		InnerRate:       0, // Not applicable for TokenBucket
 		InnerWindow:     0, // Not applicable for TokenBucket
+		Remaining:       tb.available(tb.clock.Now().UnixNano()),
+		QueueDepth:      tb.waiters.len(),
 	}
 }
 
+// available returns the tokens the bucket would hold after a refill at now, without refilling it
+func (tb *TokenBucket) available(now int64) int64 {
+	elapsed := time.Duration(now - atomic.LoadInt64(&tb.lastRefillTime))
+	tokens := atomic.LoadInt64(&tb.tokens) + int64(float64(atomic.LoadInt64(&tb.rate))*elapsed.Seconds())
+	return min(tokens, atomic.LoadInt64(&tb.capacity))
+}
+
 func (tb *TokenBucket) refill(now int64) {
 	last := atomic.LoadInt64(&tb.lastRefillTime)
 	elapsed := time.Duration(now - last)
-	tokensToAdd := int64(tb.rate * elapsed.Seconds())
+	tokensToAdd := int64(float64(atomic.LoadInt64(&tb.rate)) * elapsed.Seconds())
 	if tokensToAdd > 0 {
 		newTokens := atomic.AddInt64(&tb.tokens, tokensToAdd)
-		if newTokens > int64(tb.capacity) {
-			atomic.StoreInt64(&tb.tokens, int64(tb.capacity))
+		if capacity := atomic.LoadInt64(&tb.capacity); newTokens > capacity {
+			atomic.StoreInt64(&tb.tokens, capacity)
 		}
 		atomic.StoreInt64(&tb.lastRefillTime, now)
 	}
 }
 
+// adjust takes tokens from the bucket, possibly into deficit, or gives them back when negative
+func (tb *TokenBucket) adjust(tokens int) {
+	if capacity := atomic.LoadInt64(&tb.capacity); atomic.AddInt64(&tb.tokens, -int64(tokens)) > capacity {
+		atomic.StoreInt64(&tb.tokens, capacity)
+	}
+}
+
 func (tb *TokenBucket) timeToToken(tokens float64) time.Duration {
 	available := float64(atomic.LoadInt64(&tb.tokens))
 	if available >= tokens {
 		return 0
 	}
+	rate := atomic.LoadInt64(&tb.rate)
+	if rate <= 0 {
+		return InfDuration
+	}
 	missingTokens := tokens - available
-	return time.Duration(missingTokens / tb.rate * float64(time.Second))
+	return time.Duration(missingTokens / float64(rate) * float64(time.Second))
 }
@@ -0,0 +1,198 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"github.com/popeskul/ratelimiter"
+	"testing"
+	"time"
+)
+
+func TestTunable(t *testing.T) {
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	for _, algo := range algorithms {
+		t.Run(string(algo), func(t *testing.T) {
+			limiter, err := ratelimiter.New(
+				ratelimiter.WithAlgorithm(algo),
+				ratelimiter.WithRate(10),
+				ratelimiter.WithBurst(10),
+				ratelimiter.WithCapacity(10),
+				ratelimiter.WithWindow(time.Second),
+				ratelimiter.WithMetrics(true),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create limiter: %v", err)
+			}
+
+			tunable, ok := limiter.(ratelimiter.Tunable)
+			if !ok {
+				t.Fatal("Limiter should implement Tunable")
+			}
+
+			tunable.SetRate(20)
+			if rate := limiter.GetMetrics().CurrentRate; rate != 20 {
+				t.Errorf("Expected current rate 20, got %d", rate)
+			}
+		})
+	}
+
+	t.Run("Wakes Waiters", func(t *testing.T) {
+		for _, algo := range []ratelimiter.Algorithm{
+			ratelimiter.FixedWindowAlgorithm,
+			ratelimiter.SlidingWindowAlgorithm,
+			ratelimiter.SlidingWindowCounterAlgorithm,
+			ratelimiter.NestedWindowAlgorithm,
+		} {
+			t.Run(string(algo), func(t *testing.T) {
+				limiter, _ := ratelimiter.New(
+					ratelimiter.WithAlgorithm(algo),
+					ratelimiter.WithRate(1),
+					ratelimiter.WithBurst(1),
+					ratelimiter.WithWindow(time.Hour),
+				)
+				limiter.Allow()
+
+				done := make(chan error, 1)
+				go func() { done <- limiter.Wait(context.Background()) }()
+
+				time.Sleep(10 * time.Millisecond)
+				limiter.(ratelimiter.Tunable).SetRate(2)
+				limiter.(ratelimiter.Tunable).SetBurst(2)
+
+				select {
+				case err := <-done:
+					if err != nil {
+						t.Errorf("Wait should not error: %v", err)
+					}
+				case <-time.After(time.Second):
+					t.Error("Wait should return once the limit is raised")
+				}
+			})
+		}
+	})
+
+	t.Run("TokenBucket SetRate Wakes Waiters", func(t *testing.T) {
+		limiter := ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 1, Capacity: 1})
+		limiter.Allow()
+
+		done := make(chan error, 1)
+		go func() { done <- limiter.Wait(context.Background()) }()
+
+		time.Sleep(10 * time.Millisecond)
+		limiter.SetRate(1000)
+
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Wait should not error: %v", err)
+			}
+		case <-time.After(500 * time.Millisecond):
+			t.Error("Wait should return soon after the rate is raised")
+		}
+	})
+
+	t.Run("LeakyBucket SetRate Reschedules Queue", func(t *testing.T) {
+		limiter := ratelimiter.NewLeakyBucket(&ratelimiter.Config{Rate: 1, QueueSize: 10})
+		limiter.Allow()
+
+		done := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { done <- limiter.Wait(context.Background()) }()
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		limiter.SetRate(1000)
+
+		for i := 0; i < 2; i++ {
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Errorf("Wait should not error: %v", err)
+				}
+			case <-time.After(500 * time.Millisecond):
+				t.Fatal("Queued callers should be released sooner once the rate is raised")
+			}
+		}
+		if limiter.QueueLength() != 0 {
+			t.Errorf("Expected an empty queue, got %d", limiter.QueueLength())
+		}
+	})
+
+	t.Run("TokenBucket SetCapacity", func(t *testing.T) {
+		limiter := ratelimiter.NewTokenBucket(&ratelimiter.Config{Rate: 1, Capacity: 10})
+		limiter.AllowN(5)
+
+		limiter.SetCapacity(20)
+		if remaining := limiter.GetMetrics().Remaining; remaining != 10 {
+			t.Errorf("Expected a half full bucket of 10 tokens, got %d", remaining)
+		}
+
+		limiter.SetCapacity(4)
+		if remaining := limiter.GetMetrics().Remaining; remaining != 2 {
+			t.Errorf("Expected a half full bucket of 2 tokens, got %d", remaining)
+		}
+	})
+
+	t.Run("FixedWindow SetWindow", func(t *testing.T) {
+		limiter := ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 2, Window: time.Hour})
+		limiter.AllowN(2)
+
+		limiter.SetWindow(50 * time.Millisecond)
+		if limiter.Allow() {
+			t.Error("Requests counted in the current window should be kept")
+		}
+
+		time.Sleep(60 * time.Millisecond)
+		if !limiter.AllowN(2) {
+			t.Error("AllowN(2) should be allowed once the shorter window has ended")
+		}
+		if window := limiter.GetMetrics().WindowDuration; window != 50*time.Millisecond {
+			t.Errorf("Expected window duration 50ms, got %v", window)
+		}
+	})
+
+	t.Run("Zero Window", func(t *testing.T) {
+		for _, algo := range algorithms {
+			t.Run(string(algo), func(t *testing.T) {
+				limiter, _ := ratelimiter.New(
+					ratelimiter.WithAlgorithm(algo),
+					ratelimiter.WithRate(2),
+					ratelimiter.WithBurst(2),
+					ratelimiter.WithCapacity(2),
+					ratelimiter.WithWindow(time.Second),
+				)
+				limiter.Allow()
+				limiter.(ratelimiter.Tunable).SetWindow(0)
+
+				limiter.Allow()
+				limiter.AllowN(3)
+				limiter.GetMetrics()
+				ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+				defer cancel()
+				// Whether the wait is admitted does not matter, only that it returns
+				_ = limiter.Wait(ctx)
+			})
+		}
+	})
+
+	t.Run("SlidingWindow SetRate Keeps State", func(t *testing.T) {
+		limiter := ratelimiter.NewSlidingWindow(&ratelimiter.Config{Rate: 5, Window: time.Hour})
+		limiter.AllowN(4)
+
+		limiter.SetRate(6)
+		if !limiter.AllowN(2) {
+			t.Error("AllowN(2) should fit under the raised rate")
+		}
+		if limiter.Allow() {
+			t.Error("Request should be denied once the raised rate is used up")
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes a single invalid Config field
+type FieldError struct {
+	Field  string // name of the Config field
+	Value  any    // the invalid value
+	Reason string // what the value should have been
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s %s, got %v", e.Field, e.Reason, e.Value)
+}
+
+// ConfigError is returned by Config.Validate and New when a Config is invalid.
+// It lists every invalid field and matches ErrInvalidConfig with errors.Is.
+type ConfigError struct {
+	Algorithm Algorithm
+	Fields    []*FieldError
+}
+
+func (e *ConfigError) Error() string {
+	reasons := make([]string, len(e.Fields))
+	for i, field := range e.Fields {
+		reasons[i] = field.Error()
+	}
+	return fmt.Sprintf("%v for %s: %s", ErrInvalidConfig, e.Algorithm, strings.Join(reasons, "; "))
+}
+
+func (e *ConfigError) Is(target error) bool {
+	return target == ErrInvalidConfig
+}
+
+func (e *ConfigError) Unwrap() []error {
+	errs := make([]error, len(e.Fields))
+	for i, field := range e.Fields {
+		errs[i] = field
+	}
+	return errs
+}
+
+// Validate checks the Config against the rules of its Algorithm and returns a
+// *ConfigError listing every invalid field, or nil if the Config is valid. An
+// unknown Algorithm is reported as ErrUnsupportedAlgorithm on its own, since
+// the other rules depend on it. For an algorithm added with RegisterAlgorithm
+// only the checks common to every algorithm apply; the rest are up to its factory.
+func (c *Config) Validate() error {
+	var windowed, custom bool
+	switch c.Algorithm {
+	case TokenBucketAlgorithm, LeakyBucketAlgorithm:
+	case FixedWindowAlgorithm, SlidingWindowAlgorithm, SlidingWindowCounterAlgorithm,
+		NestedWindowAlgorithm, GCRAAlgorithm:
+		windowed = true
+	default:
+		if _, ok := lookupAlgorithm(c.Algorithm); !ok {
+			return ErrUnsupportedAlgorithm
+		}
+		custom = true
+	}
+
+	var fields []*FieldError
+	check := func(ok bool, field string, value any, reason string) {
+		if !ok {
+			fields = append(fields, &FieldError{Field: field, Value: value, Reason: reason})
+		}
+	}
+
+	if custom {
+		check(c.Rate >= 0, "Rate", c.Rate, "must not be negative")
+	} else {
+		check(c.Rate > 0, "Rate", c.Rate, "must be positive")
+	}
+	if c.Algorithm == NestedWindowAlgorithm {
+		check(c.Burst > 0, "Burst", c.Burst, "must be positive")
+	} else {
+		check(c.Burst >= 0, "Burst", c.Burst, "must not be negative")
+	}
+	if c.Algorithm == TokenBucketAlgorithm {
+		check(c.Capacity > 0, "Capacity", c.Capacity, "must be positive")
+	} else {
+		check(c.Capacity >= 0, "Capacity", c.Capacity, "must not be negative")
+	}
+	if windowed {
+		check(c.Window > 0, "Window", c.Window, "must be positive")
+	} else {
+		check(c.Window >= 0, "Window", c.Window, "must not be negative")
+	}
+	if c.Algorithm == NestedWindowAlgorithm {
+		check(c.InnerWindow >= 0, "InnerWindow", c.InnerWindow, "must not be negative")
+		check(c.InnerWindow <= c.Window, "InnerWindow", c.InnerWindow, "must not exceed Window")
+	}
+	check(c.QueueSize >= 0, "QueueSize", c.QueueSize, "must not be negative")
+	check(c.MaxWaiters >= 0, "MaxWaiters", c.MaxWaiters, "must not be negative")
+	check(c.MaxInFlight >= 0, "MaxInFlight", c.MaxInFlight, "must not be negative")
+	check(c.KeyTTL >= 0, "KeyTTL", c.KeyTTL, "must not be negative")
+	check(c.MaxKeys >= 0, "MaxKeys", c.MaxKeys, "must not be negative")
+	check(c.Shards >= 0, "Shards", c.Shards, "must not be negative")
+
+	if len(fields) > 0 {
+		return &ConfigError{Algorithm: c.Algorithm, Fields: fields}
+	}
+	return nil
+}
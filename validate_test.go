@@ -0,0 +1,152 @@
+package ratelimiter_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestConfigValidate(t *testing.T) {
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	fieldsOf := func(t *testing.T, err error) []string {
+		t.Helper()
+		var configErr *ratelimiter.ConfigError
+		if !errors.As(err, &configErr) {
+			t.Fatalf("Expected a ConfigError, got %v", err)
+		}
+		var fields []string
+		for _, field := range configErr.Fields {
+			fields = append(fields, field.Field)
+		}
+		return fields
+	}
+
+	for _, algo := range algorithms {
+		t.Run(string(algo)+" Default Config", func(t *testing.T) {
+			config := ratelimiter.DefaultConfig()
+			config.Algorithm = algo
+			if err := config.Validate(); err != nil {
+				t.Errorf("Default config should be valid, got %v", err)
+			}
+		})
+
+		t.Run(string(algo)+" Zero Rate", func(t *testing.T) {
+			_, err := ratelimiter.New(ratelimiter.WithAlgorithm(algo), ratelimiter.WithRate(0))
+			if !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+				t.Fatalf("Expected ErrInvalidConfig, got %v", err)
+			}
+			if fields := fieldsOf(t, err); len(fields) != 1 || fields[0] != "Rate" {
+				t.Errorf("Expected only Rate to be invalid, got %v", fields)
+			}
+		})
+	}
+
+	t.Run("Lists Every Invalid Field", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		config.Algorithm = ratelimiter.NestedWindowAlgorithm
+		config.Rate = 0
+		config.Burst = 0
+		config.Capacity = -1
+		config.Window = time.Second
+		config.InnerWindow = 2 * time.Second
+		config.MaxWaiters = -1
+
+		err := config.Validate()
+		fields := fieldsOf(t, err)
+		want := []string{"Rate", "Burst", "Capacity", "InnerWindow", "MaxWaiters"}
+		if strings.Join(fields, ",") != strings.Join(want, ",") {
+			t.Errorf("Expected invalid fields %v, got %v", want, fields)
+		}
+		if !strings.Contains(err.Error(), "InnerWindow must not exceed Window, got 2s") {
+			t.Errorf("Error should explain each field, got %q", err.Error())
+		}
+
+		var fieldErr *ratelimiter.FieldError
+		if !errors.As(err, &fieldErr) || fieldErr.Field != "Rate" {
+			t.Errorf("Expected errors.As to find the first FieldError, got %v", fieldErr)
+		}
+	})
+
+	t.Run("Per Algorithm Rules", func(t *testing.T) {
+		tests := []struct {
+			algo  ratelimiter.Algorithm
+			opts  []ratelimiter.Option
+			field string
+		}{
+			{ratelimiter.TokenBucketAlgorithm, []ratelimiter.Option{ratelimiter.WithCapacity(0)}, "Capacity"},
+			{ratelimiter.FixedWindowAlgorithm, []ratelimiter.Option{ratelimiter.WithWindow(0)}, "Window"},
+			{ratelimiter.GCRAAlgorithm, []ratelimiter.Option{ratelimiter.WithWindow(-time.Second)}, "Window"},
+			{ratelimiter.NestedWindowAlgorithm, []ratelimiter.Option{ratelimiter.WithBurst(0)}, "Burst"},
+			{ratelimiter.LeakyBucketAlgorithm, []ratelimiter.Option{ratelimiter.WithQueueSize(-1)}, "QueueSize"},
+		}
+		for _, tt := range tests {
+			_, err := ratelimiter.New(append(tt.opts, ratelimiter.WithAlgorithm(tt.algo))...)
+			if fields := fieldsOf(t, err); len(fields) != 1 || fields[0] != tt.field {
+				t.Errorf("%s: expected only %s to be invalid, got %v", tt.algo, tt.field, fields)
+			}
+		}
+
+		// A zero capacity or window only matters to the algorithms that use it
+		if _, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(ratelimiter.LeakyBucketAlgorithm),
+			ratelimiter.WithCapacity(0),
+			ratelimiter.WithWindow(0),
+		); err != nil {
+			t.Errorf("Leaky bucket should ignore capacity and window, got %v", err)
+		}
+	})
+
+	t.Run("Unsupported Algorithm", func(t *testing.T) {
+		config := ratelimiter.DefaultConfig()
+		config.Algorithm = "unknown"
+		config.Rate = 0
+		if err := config.Validate(); err != ratelimiter.ErrUnsupportedAlgorithm {
+			t.Errorf("Expected ErrUnsupportedAlgorithm, got %v", err)
+		}
+	})
+
+	t.Run("Keyed And Concurrency", func(t *testing.T) {
+		if _, err := ratelimiter.NewKeyedLimiter(ratelimiter.WithRate(-1)); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+			t.Errorf("NewKeyedLimiter: expected ErrInvalidConfig, got %v", err)
+		}
+		if _, err := ratelimiter.NewConcurrency(
+			ratelimiter.WithRateLimited(true),
+			ratelimiter.WithRate(0),
+		); !errors.Is(err, ratelimiter.ErrInvalidConfig) {
+			t.Errorf("NewConcurrency: expected ErrInvalidConfig, got %v", err)
+		}
+		for _, maxInFlight := range []int{0, -1} {
+			_, err := ratelimiter.NewConcurrency(ratelimiter.WithMaxInFlight(maxInFlight))
+			var configErr *ratelimiter.ConfigError
+			if !errors.As(err, &configErr) || configErr.Fields[0].Field != "MaxInFlight" {
+				t.Errorf("NewConcurrency: expected MaxInFlight %d to be invalid, got %v", maxInFlight, err)
+			}
+		}
+	})
+
+	t.Run("Inner Window", func(t *testing.T) {
+		limiter, err := ratelimiter.New(
+			ratelimiter.WithAlgorithm(ratelimiter.NestedWindowAlgorithm),
+			ratelimiter.WithWindow(time.Second),
+			ratelimiter.WithInnerWindow(250*time.Millisecond),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create limiter: %v", err)
+		}
+		if got := limiter.GetMetrics().InnerWindow; got != 250*time.Millisecond {
+			t.Errorf("Expected inner window 250ms, got %v", got)
+		}
+	})
+}
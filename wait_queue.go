@@ -0,0 +1,33 @@
+package ratelimiter
+
+import "sync/atomic"
+
+// waitQueue counts the callers blocked in Wait and bounds how many there may be.
+// A limit of 0 means no bound.
+type waitQueue struct {
+	limit int64
+	depth int64
+}
+
+func newWaitQueue(limit int) waitQueue {
+	return waitQueue{limit: int64(max(limit, 0))}
+}
+
+// enter joins the queue and reports whether there was room; callers that
+// joined must leave when they stop waiting
+func (q *waitQueue) enter() bool {
+	if depth := atomic.AddInt64(&q.depth, 1); q.limit > 0 && depth > q.limit {
+		atomic.AddInt64(&q.depth, -1)
+		return false
+	}
+	return true
+}
+
+func (q *waitQueue) leave() {
+	atomic.AddInt64(&q.depth, -1)
+}
+
+// len returns the number of callers in the queue
+func (q *waitQueue) len() int64 {
+	return atomic.LoadInt64(&q.depth)
+}
@@ -0,0 +1,116 @@
+package ratelimiter_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/popeskul/ratelimiter"
+)
+
+func TestMaxWaiters(t *testing.T) {
+	algorithms := []ratelimiter.Algorithm{
+		ratelimiter.TokenBucketAlgorithm,
+		ratelimiter.FixedWindowAlgorithm,
+		ratelimiter.SlidingWindowAlgorithm,
+		ratelimiter.SlidingWindowCounterAlgorithm,
+		ratelimiter.NestedWindowAlgorithm,
+		ratelimiter.GCRAAlgorithm,
+		ratelimiter.LeakyBucketAlgorithm,
+	}
+
+	for _, algo := range algorithms {
+		t.Run(string(algo), func(t *testing.T) {
+			clock := ratelimiter.NewFakeClock(time.Now())
+			limiter, err := ratelimiter.New(
+				ratelimiter.WithAlgorithm(algo),
+				ratelimiter.WithRate(1),
+				ratelimiter.WithBurst(1),
+				ratelimiter.WithCapacity(1),
+				ratelimiter.WithWindow(time.Hour),
+				ratelimiter.WithMaxWaiters(2),
+				ratelimiter.WithClock(clock),
+				ratelimiter.WithMetrics(true),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create limiter: %v", err)
+			}
+			limiter.Allow()
+
+			errs := make(chan error, 2)
+			for i := 0; i < 2; i++ {
+				go func() { errs <- limiter.Wait(context.Background()) }()
+			}
+			clock.BlockUntil(2)
+
+			if depth := limiter.GetMetrics().QueueDepth; depth != 2 {
+				t.Errorf("Expected a queue depth of 2, got %d", depth)
+			}
+			if err := limiter.Wait(context.Background()); !errors.Is(err, ratelimiter.ErrTooManyWaiters) {
+				t.Errorf("Expected ErrTooManyWaiters, got %v", err)
+			}
+
+			if err := limiter.(ratelimiter.Closer).Close(); err != nil {
+				t.Fatalf("Close failed: %v", err)
+			}
+			for i := 0; i < 2; i++ {
+				if err := <-errs; !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+					t.Errorf("Expected queued waiters to get ErrLimiterClosed, got %v", err)
+				}
+			}
+			if depth := limiter.GetMetrics().QueueDepth; depth != 0 {
+				t.Errorf("Expected an empty queue after the waiters left, got %d", depth)
+			}
+		})
+	}
+
+	t.Run("Unbounded By Default", func(t *testing.T) {
+		clock := ratelimiter.NewFakeClock(time.Now())
+		limiter := ratelimiter.NewFixedWindow(&ratelimiter.Config{Rate: 1, Window: time.Hour, Clock: clock})
+		limiter.Allow()
+
+		errs := make(chan error, 50)
+		for i := 0; i < 50; i++ {
+			go func() { errs <- limiter.Wait(context.Background()) }()
+		}
+		clock.BlockUntil(50)
+
+		if depth := limiter.GetMetrics().QueueDepth; depth != 50 {
+			t.Errorf("Expected a queue depth of 50, got %d", depth)
+		}
+		if err := limiter.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		for i := 0; i < 50; i++ {
+			if err := <-errs; !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+				t.Errorf("Expected queued waiters to get ErrLimiterClosed, got %v", err)
+			}
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		limiter, _ := ratelimiter.NewConcurrency(ratelimiter.WithMaxInFlight(1), ratelimiter.WithMaxWaiters(1))
+		release, _ := limiter.Acquire(context.Background())
+		defer release()
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := limiter.Acquire(context.Background())
+			done <- err
+		}()
+		for limiter.GetMetrics().QueueDepth != 1 {
+			time.Sleep(time.Millisecond)
+		}
+
+		if _, err := limiter.Acquire(context.Background()); !errors.Is(err, ratelimiter.ErrTooManyWaiters) {
+			t.Errorf("Expected ErrTooManyWaiters, got %v", err)
+		}
+		if err := limiter.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+		if err := <-done; !errors.Is(err, ratelimiter.ErrLimiterClosed) {
+			t.Errorf("Expected the queued Acquire to get ErrLimiterClosed, got %v", err)
+		}
+	})
+}
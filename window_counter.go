@@ -0,0 +1,205 @@
+package ratelimiter
+
+import "time"
+
+// windowCounter counts usage in consecutive fixed windows aligned to the time
+// it was created. Usage reserved for later windows is kept until they begin.
+// It is not safe for concurrent use; the owning limiter guards it.
+type windowCounter struct {
+	window int64           // window length in nanoseconds
+	start  int64           // start of the current window in unix nanoseconds
+	count  int64           // usage of the current window
+	future map[int64]int64 // usage reserved in later windows, by window start
+	full   []fullSpan      // later windows filled by carried debt, in addition to future
+}
+
+// fullSpan is a run of windows, from the one beginning at start up to the one
+// beginning at end, each filled up to limit. Debt spanning many windows is
+// kept as one span rather than a count per window.
+type fullSpan struct {
+	start int64
+	end   int64
+	limit int64
+}
+
+func newWindowCounter(window time.Duration, now int64) windowCounter {
+	return windowCounter{
+		window: window.Nanoseconds(),
+		start:  now,
+	}
+}
+
+// untilNext returns how long from now until the current window ends
+func (wc *windowCounter) untilNext(now int64) time.Duration {
+	return time.Duration(max(wc.start+wc.window-now, 0))
+}
+
+// advance moves the counter to the window containing now
+func (wc *windowCounter) advance(now int64) {
+	if wc.window <= 0 {
+		wc.start = now
+		wc.count = 0
+		return
+	}
+	elapsed := now - wc.start
+	if elapsed < wc.window {
+		return
+	}
+	wc.start += elapsed / wc.window * wc.window
+	wc.count = wc.future[wc.start] + wc.spanLimit(wc.start)
+	for start := range wc.future {
+		if start <= wc.start {
+			delete(wc.future, start)
+		}
+	}
+	spans := wc.full[:0]
+	for _, span := range wc.full {
+		if span.start = max(span.start, wc.start+wc.window); span.start < span.end {
+			spans = append(spans, span)
+		}
+	}
+	wc.full = spans
+}
+
+// windowOf returns the start of the window containing t, which must not be before the current window
+func (wc *windowCounter) windowOf(t int64) int64 {
+	if wc.window <= 0 || t <= wc.start {
+		return wc.start
+	}
+	return wc.start + (t-wc.start)/wc.window*wc.window
+}
+
+// used returns the usage of the window beginning at start
+func (wc *windowCounter) used(start int64) int64 {
+	if start == wc.start {
+		return wc.count
+	}
+	return wc.future[start] + wc.spanLimit(start)
+}
+
+// spanLimit returns the usage carried debt fills the window beginning at start with
+func (wc *windowCounter) spanLimit(start int64) int64 {
+	for _, span := range wc.full {
+		if span.start <= start && start < span.end {
+			return span.limit
+		}
+	}
+	return 0
+}
+
+// after returns the start of the next window that may have room for n under
+// limit after the one beginning at start, skipping the rest of a run of
+// windows filled by debt in one step
+func (wc *windowCounter) after(start, n, limit int64) int64 {
+	for _, span := range wc.full {
+		if span.start <= start && start < span.end && span.limit+n > limit {
+			return span.end
+		}
+	}
+	return start + wc.window
+}
+
+// add changes the usage of the window beginning at start. Windows that have
+// already ended are left alone and usage never drops below zero.
+func (wc *windowCounter) add(start, n int64) {
+	switch {
+	case start < wc.start:
+		return
+	case start == wc.start:
+		wc.count = max(wc.count+n, 0)
+	default:
+		if wc.future == nil {
+			wc.future = make(map[int64]int64)
+		}
+		if count := wc.future[start] + n; count > 0 {
+			wc.future[start] = count
+		} else {
+			delete(wc.future, start)
+		}
+	}
+}
+
+// charge adds n to the window beginning at start, or to the current window if
+// that one has ended, and carries whatever exceeds limit over into the
+// following windows so that debt is paid off rather than forgotten
+func (wc *windowCounter) charge(start, n, limit int64) {
+	start = max(start, wc.start)
+	wc.add(start, n)
+	if limit <= 0 || wc.window <= 0 {
+		return
+	}
+	recorded := wc.count
+	if start != wc.start {
+		recorded = wc.future[start]
+	}
+	if excess := min(wc.used(start)-limit, recorded); excess > 0 {
+		wc.add(start, -excess)
+		wc.carry(start+wc.window, excess, limit)
+	}
+}
+
+// carry fills the windows from the one beginning at from with n, up to limit
+// each. Usage already in those windows is taken in and carried along with n,
+// so every window the debt covers ends up exactly at limit and only the last
+// one keeps a remainder. It takes time in the number of reservations and
+// spans, not in the number of windows covered.
+func (wc *windowCounter) carry(from, n, limit int64) {
+	for {
+		end := from + (n+limit-1)/limit*wc.window
+		taken := false
+		for start, count := range wc.future {
+			if from <= start && start < end {
+				n += count
+				delete(wc.future, start)
+				taken = true
+			}
+		}
+		spans := wc.full[:0]
+		for _, span := range wc.full {
+			if span.end <= from || span.start >= end {
+				spans = append(spans, span)
+				continue
+			}
+			n += (span.end - max(span.start, from)) / wc.window * span.limit
+			if span.start < from {
+				span.end = from
+				spans = append(spans, span)
+			}
+			taken = true
+		}
+		wc.full = spans
+		if !taken {
+			break
+		}
+	}
+
+	filled := from + n/limit*wc.window
+	if filled > from {
+		wc.full = append(wc.full, fullSpan{start: from, end: filled, limit: limit})
+	}
+	wc.add(filled, n%limit)
+}
+
+// resize changes the window length. The current window keeps its start and
+// usage; usage reserved in later windows moves to the window of the new length
+// that contains its old start.
+func (wc *windowCounter) resize(window time.Duration) {
+	future, full, oldWindow := wc.future, wc.full, wc.window
+	wc.window = window.Nanoseconds()
+	wc.future = nil
+	wc.full = nil
+	for start, n := range future {
+		wc.add(wc.windowOf(start), n)
+	}
+	for _, span := range full {
+		wc.charge(wc.windowOf(span.start), (span.end-span.start)/oldWindow*span.limit, span.limit)
+	}
+}
+
+// reset clears all usage and starts a new window at now
+func (wc *windowCounter) reset(now int64) {
+	wc.start = now
+	wc.count = 0
+	wc.future = nil
+	wc.full = nil
+}